@@ -0,0 +1,80 @@
+package namespace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// ThreadReport is a thread found by AuditThreads in other namespaces than the thread group leader
+type ThreadReport struct {
+	// TID of the thread
+	TID int
+	// Diverged has the types the thread is in another namespace of
+	Diverged Mask
+	// Namespaces of the thread for the diverged types
+	Namespaces map[Type]ID
+}
+
+// AuditThreads compares the namespaces of every thread of the calling process to the ones of the thread group
+// leader and returns the threads that differ, sorted by tid. A thread left in a foreign namespace, e.g. after Set
+// without runtime.LockOSThread, can run any goroutine. Threads that exit during the audit are skipped. Needs procfs.
+func AuditThreads() ([]ThreadReport, error) {
+	pid := strconv.Itoa(os.Getpid())
+	leader := map[Type]ID{}
+	for _, t := range Types() {
+		id, err := statID(filepath.Join(PROCFSPath, pid, "ns", t.StringLower()), t)
+		if err != nil {
+			// the kernel doesn't support the type
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, NewError("stat", "", t, err)
+		}
+		leader[t] = id
+	}
+
+	d, err := os.Open(filepath.Join(PROCFSPath, pid, "task"))
+	if err != nil {
+		return nil, NewError("open", "", INVALID, err)
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return nil, NewError("readdir", d.Name(), INVALID, err)
+	}
+
+	out := []ThreadReport{}
+	for _, name := range names {
+		tid, err := strconv.Atoi(name)
+		if err != nil || name == pid {
+			continue
+		}
+		rep := ThreadReport{
+			TID:        tid,
+			Namespaces: map[Type]ID{},
+		}
+		for t := range leader {
+			id, err := statID(filepath.Join(PROCFSPath, pid, "task", name, "ns", t.StringLower()), t)
+			if err != nil {
+				if skipProcErr(err) {
+					continue
+				}
+				return nil, NewError("stat", "", t, err)
+			}
+			if id != leader[t] {
+				rep.Diverged = rep.Diverged.Set(t)
+				rep.Namespaces[t] = id
+			}
+		}
+		if rep.Diverged != NewMask() {
+			out = append(out, rep)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].TID < out[j].TID
+	})
+	return out, nil
+}
@@ -0,0 +1,52 @@
+package namespace
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestAuditThreads(t *testing.T) {
+	nss, err := Unshare(NewMask().Set(NET))
+	if err != nil {
+		t.Fatal(err)
+	}
+	net := nss[NET]
+	defer net.Close()
+
+	tidc := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+	go onLockedThread(func() bool {
+		if err := net.Set(); err != nil {
+			t.Error(err)
+			close(tidc)
+			return false
+		}
+		tidc <- unix.Gettid()
+		<-done
+		return false
+	})
+	tid, ok := <-tidc
+	if !ok {
+		t.FailNow()
+	}
+
+	reps, err := AuditThreads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rep := range reps {
+		if rep.TID != tid {
+			continue
+		}
+		if rep.Diverged != NewMask().Set(NET) {
+			t.Fatalf("expecting only net to diverge but got %x", rep.Diverged)
+		}
+		if !rep.Namespaces[NET].Equal(net.ID()) {
+			t.Fatalf("expecting %s but got %s", net.ID(), rep.Namespaces[NET])
+		}
+		return
+	}
+	t.Fatal("tainted thread not reported", tid)
+}
@@ -0,0 +1,205 @@
+package namespace
+
+import (
+	"errors"
+	"runtime"
+	"sort"
+
+	"golang.org/x/sys/unix"
+)
+
+// Step is a stage of running a function inside namespaces
+type Step int
+
+const (
+	// StepSave saving the namespaces of the thread
+	StepSave Step = iota
+	// StepEnter entering the target namespaces
+	StepEnter
+	// StepRun running the function
+	StepRun
+	// StepRestore restoring the saved namespaces
+	StepRestore
+)
+
+var stepNameMap = map[Step]string{
+	StepSave:    "save",
+	StepEnter:   "enter",
+	StepRun:     "run",
+	StepRestore: "restore",
+}
+
+// String returns the lower case name of the step
+func (s Step) String() string {
+	if n, ok := stepNameMap[s]; ok {
+		return n
+	}
+	return ""
+}
+
+// DoError is returned by Do and DoProcess when one of the steps fails
+type DoError struct {
+	// Step that failed
+	Step Step
+	// Type of namespace the step failed for. INVALID if the step does not act on a single type
+	Type Type
+	// Err is the underlying error
+	Err error
+}
+
+func (e *DoError) Error() string {
+	if e.Type == INVALID {
+		return e.Step.String() + ": " + e.Err.Error()
+	}
+	return e.Step.String() + " " + e.Type.StringLower() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *DoError) Unwrap() error {
+	return e.Err
+}
+
+// Do runs fn inside ns. See Do
+func (ns *Namespace) Do(fn func() error) error {
+	return Do(fn, ns)
+}
+
+// doAs runs fn inside ns and returns the error of fn as is. If ns is not of type t a *NamespaceError for
+// op and typeErr is returned instead.
+func (ns *Namespace) doAs(t Type, op string, typeErr error, fn func() error) error {
+	if ns.Type() != t {
+		return ns.error(op, typeErr)
+	}
+	err := ns.Do(fn)
+	var derr *DoError
+	if errors.As(err, &derr) && derr.Step == StepRun {
+		return derr.Err
+	}
+	return err
+}
+
+// Do runs fn inside nss on a dedicated OS thread and waits for it to return. The current namespaces
+// are saved with Self, the thread enters nss with user first, runs fn and restores the saved ones.
+// If restoring fails the thread is never handed back to the runtime and exits instead. fn must not
+// start goroutines that expect to be inside nss. Errors are of type *DoError.
+//
+// User and time namespaces are not supported, the kernel only lets a single threaded process enter them
+// and entering fails with EINVAL or EUSERS. Use StartProcess or the reexec package for them. Entering a
+// mount namespace unshares the filesystem attributes of the thread, which is discarded instead of restored.
+func Do(fn func() error, nss ...*Namespace) error {
+	nss, m := sortNamespaces(nss)
+	return do(m, func() *DoError {
+		return setAll(nss)
+	}, fn)
+}
+
+// setAll sets the namespaces in order and returns a *DoError for the first that fails
+func setAll(nss []*Namespace) *DoError {
+	for _, ns := range nss {
+		if err := ns.Set(); err != nil {
+			return &DoError{Step: StepEnter, Type: ns.Type(), Err: err}
+		}
+	}
+	return nil
+}
+
+// DoProcess runs fn inside the namespaces of process pid of the types in m. The namespaces are
+// entered with SetFromProcess, otherwise it is the same as Do and doesn't support USER and TIME either.
+func DoProcess(pid int, m Mask, fn func() error) error {
+	return do(m, func() *DoError {
+		if err := SetFromProcess(pid, m); err != nil {
+			return &DoError{Step: StepEnter, Err: err}
+		}
+		return nil
+	}, fn)
+}
+
+func do(m Mask, enter func() *DoError, fn func() error) error {
+	var err error
+	onLockedThread(func() bool {
+		saved := []*Namespace{}
+		defer func() {
+			for _, ns := range saved {
+				ns.Close()
+			}
+		}()
+		for _, t := range m.Types() {
+			ns, e := Self(t)
+			if e != nil {
+				err = &DoError{Step: StepSave, Type: t, Err: e}
+				return true
+			}
+			saved = append(saved, ns)
+		}
+		if m.Has(MNT) {
+			// setns to a mount namespace fails if the thread shares its root and cwd with others
+			if e := unix.Unshare(unix.CLONE_FS); e != nil {
+				err = &DoError{Step: StepEnter, Type: MNT, Err: e}
+				return true
+			}
+		}
+		if e := enter(); e != nil {
+			err = e
+		} else if e := fn(); e != nil {
+			err = &DoError{Step: StepRun, Err: e}
+		}
+		if m.Has(MNT) || m.Has(TIME) {
+			return false
+		}
+		for _, ns := range saved {
+			if e := ns.Set(); e != nil {
+				// an error from fn or enter is more interesting to the caller
+				if err == nil {
+					err = &DoError{Step: StepRestore, Type: ns.Type(), Err: e}
+				}
+				return false
+			}
+		}
+		return true
+	})
+	return err
+}
+
+// onLockedThread runs fn on a new goroutine locked to its OS thread and waits for it to return. The
+// thread is handed back to the runtime only if fn returns true, otherwise it exits with the goroutine.
+// fn never runs on the main thread.
+func onLockedThread(fn func() bool) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runtime.LockOSThread()
+		if unix.Gettid() == unix.Getpid() {
+			// the runtime wedges the main thread instead of terminating it and it is the one procfs
+			// reports as self. keep it locked so fn has to run on another thread.
+			onLockedThread(fn)
+			runtime.UnlockOSThread()
+			return
+		}
+		if fn() {
+			runtime.UnlockOSThread()
+		}
+	}()
+	<-done
+}
+
+// sortNamespaces returns a copy of nss in the order they should be entered and the mask of their types
+func sortNamespaces(nss []*Namespace) ([]*Namespace, Mask) {
+	nss = append([]*Namespace{}, nss...)
+	sort.SliceStable(nss, func(i, j int) bool {
+		return setnsIndex(nss[i].Type()) < setnsIndex(nss[j].Type())
+	})
+	m := NewMask()
+	for _, ns := range nss {
+		m = m.Set(ns.Type())
+	}
+	return nss, m
+}
+
+func setnsIndex(t Type) int {
+	for i, o := range setnsOrder {
+		if o == t {
+			return i
+		}
+	}
+	return len(setnsOrder)
+}
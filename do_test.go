@@ -0,0 +1,155 @@
+package namespace
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func threadIno(t Type) (uint64, error) {
+	ns, err := ThreadSelf(t)
+	if err != nil {
+		return 0, err
+	}
+	defer ns.Close()
+	return ns.Ino(), nil
+}
+
+func TestDo(t *testing.T) {
+	m := NewMask().Set(NET).Set(UTS).Set(MNT)
+
+	c, err := newProcess(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+
+	ppid := c.Process.Pid
+
+	nss := []*Namespace{}
+	for _, nsType := range m.Types() {
+		ns, err := FromPID(ppid, nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ns.Close()
+		nss = append(nss, ns)
+	}
+
+	err = Do(func() error {
+		for _, ns := range nss {
+			ino, err := threadIno(ns.Type())
+			if err != nil {
+				return err
+			}
+			if ino != ns.Ino() {
+				t.Errorf("thread not in %s ns of %d", ns.Type(), ppid)
+			}
+		}
+		return nil
+	}, nss...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errFn := errors.New("fn failed")
+	err = nss[0].Do(func() error {
+		return errFn
+	})
+	derr, ok := err.(*DoError)
+	if !ok {
+		t.Fatalf("expecting *DoError but got %T", err)
+	}
+	if derr.Step != StepRun || derr.Err != errFn {
+		t.Fatal("expecting run step to fail with errFn instead of", derr)
+	}
+
+	err = DoProcess(ppid, m, func() error {
+		for _, nsType := range m.Types() {
+			ino, err := threadIno(nsType)
+			if err != nil {
+				return err
+			}
+			self, err := Self(nsType)
+			if err != nil {
+				return err
+			}
+			if ino == self.Ino() {
+				t.Errorf("thread still in own %s ns", nsType)
+			}
+			self.Close()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDoEnterFail(t *testing.T) {
+	c, err := newProcess(NewMask().Set(USER))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+
+	ns, err := FromPID(c.Process.Pid, USER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+
+	// a multi threaded process can't change its user ns
+	err = ns.Do(func() error {
+		t.Error("fn should not run")
+		return nil
+	})
+	derr, ok := err.(*DoError)
+	if !ok {
+		t.Fatalf("expecting *DoError but got %T", err)
+	}
+	if derr.Step != StepEnter || derr.Type != USER {
+		t.Fatal("expecting enter user step to fail instead of", derr)
+	}
+}
+
+func TestOnLockedThreadNotMain(t *testing.T) {
+	self, err := Self(NET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer self.Close()
+
+	// discarded threads are left in a new net ns. the main thread would be wedged instead of exiting and
+	// Self, which reads the thread group leader, would report that ns from then on
+	for i := 0; i < 200; i++ {
+		onMain := false
+		var err error
+		onLockedThread(func() bool {
+			onMain = unix.Gettid() == unix.Getpid()
+			err = unix.Unshare(unix.CLONE_NEWNET)
+			return false
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if onMain {
+			t.Fatal("fn ran on the main thread")
+		}
+	}
+	cur, err := Self(NET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cur.Close()
+	if cur.Ino() != self.Ino() {
+		t.Fatal("expecting Self to be unchanged")
+	}
+}
@@ -0,0 +1,108 @@
+package namespace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// Info describes a namespace found by Enumerate
+type Info struct {
+	// ID of the namespace
+	ID ID
+	// PID is the representative process of the namespace, the member with the lowest pid
+	PID int
+	// PIDs of all the member processes, sorted
+	PIDs []int
+	// Owner is the owning user namespace. Zero if it is outside of the caller's namespace scope
+	Owner ID
+	// OwnerUID is the uid of the creator of the user namespace, or of the owning user namespace for other
+	// types. -1 if unknown
+	OwnerUID int
+}
+
+// Enumerate walks all processes in procfs and returns every distinct namespace of the types in m they are
+// members of, sorted by type and inode. Processes that exit during the walk and entries the caller is not
+// allowed to inspect are skipped.
+func Enumerate(m Mask) ([]*Info, error) {
+	d, err := os.Open(PROCFSPath)
+	if err != nil {
+		return nil, err
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := map[ID]*Info{}
+	for _, name := range names {
+		pid, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		for _, t := range m.Types() {
+			id, err := statID(filepath.Join(PROCFSPath, name, "ns", t.StringLower()), t)
+			if err != nil {
+				if skipProcErr(err) {
+					continue
+				}
+				return nil, err
+			}
+			inf, ok := infos[id]
+			if !ok {
+				inf = &Info{
+					ID:       id,
+					OwnerUID: -1,
+				}
+				infos[id] = inf
+			}
+			inf.PIDs = append(inf.PIDs, pid)
+		}
+	}
+
+	out := []*Info{}
+	for _, inf := range infos {
+		sort.Ints(inf.PIDs)
+		inf.PID = inf.PIDs[0]
+		for _, pid := range inf.PIDs {
+			// try the next member if the process exited
+			if err := inf.readOwner(pid); err == nil || !skipProcErr(err) {
+				break
+			}
+		}
+		out = append(out, inf)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ID.Type != out[j].ID.Type {
+			return setnsIndex(out[i].ID.Type) < setnsIndex(out[j].ID.Type)
+		}
+		return out[i].ID.Ino < out[j].ID.Ino
+	})
+	return out, nil
+}
+
+// readOwner sets Owner and OwnerUID from the namespace of pid. An owner outside of the caller's
+// namespace scope is not an error.
+func (inf *Info) readOwner(pid int) error {
+	ns, err := FromPID(pid, inf.ID.Type)
+	if err != nil {
+		return err
+	}
+	defer ns.Close()
+	if !ns.ID().Equal(inf.ID) {
+		// pid was reused or moved to another namespace
+		return os.ErrNotExist
+	}
+	inf.Owner, inf.OwnerUID, err = ownership(ns)
+	return err
+}
+
+// skipProcErr is true for errors of procfs entries of processes that exited or the caller can't inspect
+func skipProcErr(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) || errors.Is(err, unix.ESRCH)
+}
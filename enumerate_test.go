@@ -0,0 +1,84 @@
+package namespace
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEnumerate(t *testing.T) {
+	m := NewMask().Set(NET).Set(USER)
+
+	c, err := newProcess(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+
+	ppid := c.Process.Pid
+
+	infs, err := Enumerate(NewMask().SetAll())
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[ID]*Info{}
+	for _, inf := range infs {
+		if _, ok := found[inf.ID]; ok {
+			t.Fatal("duplicate namespace", inf.ID)
+		}
+		found[inf.ID] = inf
+	}
+
+	selfUser, err := Self(USER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer selfUser.Close()
+
+	for _, nsType := range Types() {
+		self, err := Self(nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inf, ok := found[self.ID()]
+		self.Close()
+		if !ok {
+			t.Fatal("own namespace not found", nsType)
+		}
+		if !hasPID(inf.PIDs, os.Getpid()) {
+			t.Fatal("own pid not a member of", inf.ID)
+		}
+	}
+
+	for _, nsType := range m.Types() {
+		ns, err := FromPID(ppid, nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inf, ok := found[ns.ID()]
+		ns.Close()
+		if !ok {
+			t.Fatal("child namespace not found", nsType)
+		}
+		if inf.PID != ppid || len(inf.PIDs) != 1 {
+			t.Fatalf("child should be the only member of %s instead of %v", inf.ID, inf.PIDs)
+		}
+		if nsType == USER && !inf.Owner.Equal(selfUser.ID()) {
+			t.Fatalf("user ns should be owned by %s instead of %s", selfUser.ID(), inf.Owner)
+		}
+		if inf.OwnerUID != os.Getuid() {
+			t.Fatalf("expecting owner uid %d but got %d", os.Getuid(), inf.OwnerUID)
+		}
+	}
+}
+
+func hasPID(pids []int, pid int) bool {
+	for _, p := range pids {
+		if p == pid {
+			return true
+		}
+	}
+	return false
+}
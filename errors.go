@@ -0,0 +1,58 @@
+package namespace
+
+import (
+	"os"
+)
+
+// NamespaceError records an error and the operation, file and namespace type that caused it. Errors from the
+// kernel are kept in Err as the errno, errors.Is also matches the package error they correspond to, e.g.
+// both unix.EPERM and ErrNotPermitted for an EPERM from Parent.
+type NamespaceError struct {
+	Op   string
+	Path string
+	Type Type
+	Err  error
+	// sentinel is the package error Err corresponds to
+	sentinel error
+}
+
+func (e *NamespaceError) Error() string {
+	s := e.Op
+	if e.Type.String() != "" {
+		s += " " + e.Type.StringLower()
+	}
+	if e.Path != "" {
+		s += " " + e.Path
+	}
+	if e.sentinel != nil && e.sentinel != e.Err {
+		return s + ": " + e.sentinel.Error() + ": " + e.Err.Error()
+	}
+	return s + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *NamespaceError) Unwrap() error {
+	return e.Err
+}
+
+// Is is true if target is the package error Err corresponds to
+func (e *NamespaceError) Is(target error) bool {
+	return e.sentinel != nil && target == e.sentinel
+}
+
+// NewError returns a *NamespaceError for err. An *os.PathError is replaced by its underlying error, and its path
+// is used if path is empty.
+func NewError(op, path string, t Type, err error) *NamespaceError {
+	if pe, ok := err.(*os.PathError); ok {
+		if path == "" {
+			path = pe.Path
+		}
+		err = pe.Err
+	}
+	return &NamespaceError{
+		Op:   op,
+		Path: path,
+		Type: t,
+		Err:  err,
+	}
+}
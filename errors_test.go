@@ -0,0 +1,52 @@
+package namespace
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestNamespaceError(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(pth, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := FromPath(pth)
+	if !errors.Is(err, ErrFileNotNamspace) {
+		t.Fatal("expecting ErrFileNotNamspace but got", err)
+	}
+	if !errors.Is(err, unix.ENOTTY) {
+		t.Fatal("expecting the ioctl errno in", err)
+	}
+	var nsErr *NamespaceError
+	if !errors.As(err, &nsErr) || nsErr.Path != pth {
+		t.Fatal("expecting *NamespaceError for path", pth, err)
+	}
+
+	_, err = FromPID(0, NET)
+	if !errors.As(err, &nsErr) || nsErr.Type != NET || nsErr.Op != "open" {
+		t.Fatal("expecting open *NamespaceError for net but got", err)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("expecting os.ErrNotExist in", err)
+	}
+
+	// either the initial user ns or the root of our scope
+	usr, err := Self(USER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer usr.Close()
+	_, err = usr.Parent()
+	if !errors.Is(err, ErrNotPermitted) || !errors.Is(err, unix.EPERM) {
+		t.Fatal("expecting ErrNotPermitted and EPERM but got", err)
+	}
+	if !errors.As(err, &nsErr) || nsErr.Path != usr.FileName() || nsErr.Type != USER {
+		t.Fatal("expecting *NamespaceError for user ns but got", err)
+	}
+}
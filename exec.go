@@ -0,0 +1,337 @@
+package namespace
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Cmd is an exec.Cmd that starts the process inside namespaces. Only Start, Run, Output and CombinedOutput
+// of Cmd place the process in the namespaces, the methods of the embedded exec.Cmd with the same names don't.
+// Use the StdinPipe, StdoutPipe and StderrPipe of Cmd too, the pipes of the embedded exec.Cmd are not closed
+// when the process is started by StartProcess.
+type Cmd struct {
+	*exec.Cmd
+	// Namespaces the process joins. The kernel only allows a single threaded process to join a user or time
+	// namespace, with either the process is started by StartProcess instead. SysProcAttr, UidMappings,
+	// GidMappings and a new user namespace in Unshare are not supported then.
+	Namespaces []*Namespace
+	// Unshare has the types of new namespaces the process is created in. A new user namespace is created first
+	// and owns the rest.
+	Unshare Mask
+	// UidMappings and GidMappings are written for a new user namespace
+	UidMappings []syscall.SysProcIDMap
+	GidMappings []syscall.SysProcIDMap
+
+	// set when started by StartProcess
+	joined bool
+	copies []chan struct{}
+
+	// pipe ends of the process closed after Start and of the caller closed after Wait
+	closeAfterStart []*os.File
+	closeAfterWait  []*os.File
+}
+
+// Command returns a Cmd to run the program name with args inside nss. If name has no path separators it is
+// looked up in PATH on Start, inside the mount namespace if nss has one.
+func Command(nss []*Namespace, name string, arg ...string) *Cmd {
+	return &Cmd{
+		Cmd: &exec.Cmd{
+			Path: name,
+			Args: append([]string{name}, arg...),
+		},
+		Namespaces: nss,
+	}
+}
+
+// Start starts the process inside the namespaces but does not wait for it to complete. The process is forked
+// from a dedicated OS thread that has joined Namespaces, so the Go restriction on mount namespaces in multi
+// threaded processes doesn't apply. With a mount or time namespace, joined or new, that thread is discarded
+// like in Do once the process started, so SysProcAttr.Pdeathsig would kill the process right away.
+func (c *Cmd) Start() error {
+	err := c.start()
+	closeFiles(c.closeAfterStart)
+	c.closeAfterStart = nil
+	if err != nil {
+		closeFiles(c.closeAfterWait)
+		c.closeAfterWait = nil
+	}
+	return err
+}
+
+func (c *Cmd) start() error {
+	nss, m := sortNamespaces(c.Namespaces)
+	if m.Has(USER) || m.Has(TIME) {
+		return c.startJoined()
+	}
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// CLONE_NEWTIME overlaps the exit signal in clone(2) flags. the thread unshares it instead and the child
+	// is created in its time_for_children
+	c.SysProcAttr.Cloneflags |= c.Unshare.CloneFlags()
+	if c.UidMappings != nil {
+		c.SysProcAttr.UidMappings = c.UidMappings
+	}
+	if c.GidMappings != nil {
+		c.SysProcAttr.GidMappings = c.GidMappings
+	}
+	if c.Unshare.Has(TIME) {
+		m = m.Set(TIME)
+	}
+	err := do(m, func() *DoError {
+		if err := setAll(nss); err != nil {
+			return err
+		}
+		if c.Unshare.Has(TIME) {
+			if err := unix.Unshare(int(TIME)); err != nil {
+				return &DoError{Step: StepEnter, Type: TIME, Err: NewError("unshare", "", TIME, err)}
+			}
+		}
+		return nil
+	}, func() error {
+		if filepath.Base(c.Path) == c.Path {
+			lp, err := exec.LookPath(c.Path)
+			if err != nil {
+				return err
+			}
+			c.Path = lp
+		}
+		return c.Cmd.Start()
+	})
+	var derr *DoError
+	if errors.As(err, &derr) && derr.Step == StepRun {
+		return derr.Err
+	}
+	return err
+}
+
+// startJoined starts the process with StartProcess, copying from and to stdio that are not files like exec.Cmd
+func (c *Cmd) startJoined() error {
+	if c.Process != nil {
+		return errors.New("exec: already started")
+	}
+	if c.SysProcAttr != nil {
+		return errors.New("exec: SysProcAttr not supported when joining user or time namespaces")
+	}
+	if c.UidMappings != nil || c.GidMappings != nil {
+		return errors.New("exec: UidMappings and GidMappings not supported when joining user or time namespaces")
+	}
+	closeAfterStart := []*os.File{}
+	defer func() {
+		for _, f := range closeAfterStart {
+			f.Close()
+		}
+	}()
+	devNull := func(flag int) (*os.File, error) {
+		f, err := os.OpenFile(os.DevNull, flag, 0)
+		if err != nil {
+			return nil, err
+		}
+		closeAfterStart = append(closeAfterStart, f)
+		return f, nil
+	}
+	copyPipe := func(fn func(r, w *os.File)) (*os.File, *os.File, error) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, nil, err
+		}
+		done := make(chan struct{})
+		go func() {
+			fn(r, w)
+			close(done)
+		}()
+		c.copies = append(c.copies, done)
+		return r, w, nil
+	}
+	output := func(w io.Writer) (*os.File, error) {
+		if f, ok := w.(*os.File); ok {
+			return f, nil
+		}
+		if w == nil {
+			return devNull(os.O_WRONLY)
+		}
+		_, pw, err := copyPipe(func(r, _ *os.File) {
+			io.Copy(w, r)
+			r.Close()
+		})
+		if err != nil {
+			return nil, err
+		}
+		closeAfterStart = append(closeAfterStart, pw)
+		return pw, nil
+	}
+
+	var stdin *os.File
+	var err error
+	switch in := c.Stdin.(type) {
+	case nil:
+		stdin, err = devNull(os.O_RDONLY)
+	case *os.File:
+		stdin = in
+	default:
+		stdin, _, err = copyPipe(func(_, w *os.File) {
+			io.Copy(w, in)
+			w.Close()
+		})
+		if err == nil {
+			closeAfterStart = append(closeAfterStart, stdin)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	stdout, err := output(c.Stdout)
+	if err != nil {
+		return err
+	}
+	stderr := stdout
+	if c.Stderr != c.Stdout {
+		if stderr, err = output(c.Stderr); err != nil {
+			return err
+		}
+	}
+
+	p, err := StartProcess(c.Path, c.Args, &ProcAttr{
+		Dir:        c.Dir,
+		Env:        c.Env,
+		Files:      append([]*os.File{stdin, stdout, stderr}, c.ExtraFiles...),
+		Namespaces: c.Namespaces,
+		Unshare:    c.Unshare,
+	})
+	if err != nil {
+		return err
+	}
+	c.Process = p
+	c.joined = true
+	return nil
+}
+
+// Wait waits for the process to exit and for copying to and from its stdio to complete, see exec.Cmd.Wait
+func (c *Cmd) Wait() error {
+	defer func() {
+		closeFiles(c.closeAfterWait)
+		c.closeAfterWait = nil
+	}()
+	if !c.joined {
+		return c.Cmd.Wait()
+	}
+	if c.ProcessState != nil {
+		return errors.New("exec: Wait was already called")
+	}
+	st, err := c.Process.Wait()
+	for _, done := range c.copies {
+		<-done
+	}
+	if err != nil {
+		return err
+	}
+	c.ProcessState = st
+	if !st.Success() {
+		return &exec.ExitError{ProcessState: st}
+	}
+	return nil
+}
+
+// StdinPipe returns a pipe connected to the standard input of the process when it starts, see
+// exec.Cmd.StdinPipe
+func (c *Cmd) StdinPipe() (io.WriteCloser, error) {
+	if c.Stdin != nil {
+		return nil, errors.New("exec: Stdin already set")
+	}
+	if c.Process != nil {
+		return nil, errors.New("exec: StdinPipe after process started")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	c.Stdin = r
+	c.closeAfterStart = append(c.closeAfterStart, r)
+	c.closeAfterWait = append(c.closeAfterWait, w)
+	return w, nil
+}
+
+// StdoutPipe returns a pipe connected to the standard output of the process when it starts, see
+// exec.Cmd.StdoutPipe
+func (c *Cmd) StdoutPipe() (io.ReadCloser, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	if c.Process != nil {
+		return nil, errors.New("exec: StdoutPipe after process started")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	c.Stdout = w
+	c.closeAfterStart = append(c.closeAfterStart, w)
+	c.closeAfterWait = append(c.closeAfterWait, r)
+	return r, nil
+}
+
+// StderrPipe returns a pipe connected to the standard error of the process when it starts, see
+// exec.Cmd.StderrPipe
+func (c *Cmd) StderrPipe() (io.ReadCloser, error) {
+	if c.Stderr != nil {
+		return nil, errors.New("exec: Stderr already set")
+	}
+	if c.Process != nil {
+		return nil, errors.New("exec: StderrPipe after process started")
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	c.Stderr = w
+	c.closeAfterStart = append(c.closeAfterStart, w)
+	c.closeAfterWait = append(c.closeAfterWait, r)
+	return r, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// Run starts the process inside the namespaces and waits for it to complete
+func (c *Cmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// Output runs the process inside the namespaces and returns its standard output
+func (c *Cmd) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	var stdout bytes.Buffer
+	c.Stdout = &stdout
+	err := c.Run()
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the process inside the namespaces and returns its combined standard output and standard error
+func (c *Cmd) CombinedOutput() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	if c.Stderr != nil {
+		return nil, errors.New("exec: Stderr already set")
+	}
+	var b bytes.Buffer
+	c.Stdout = &b
+	c.Stderr = &b
+	err := c.Run()
+	return b.Bytes(), err
+}
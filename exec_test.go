@@ -0,0 +1,178 @@
+package namespace
+
+import (
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	m := NewMask().Set(NET).Set(UTS).Set(MNT).Set(PID)
+
+	c, err := newProcess(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+
+	ppid := c.Process.Pid
+
+	nss := []*Namespace{}
+	for _, nsType := range m.Types() {
+		ns, err := FromPID(ppid, nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ns.Close()
+		nss = append(nss, ns)
+	}
+
+	args := []string{}
+	for _, nsType := range m.Types() {
+		args = append(args, "/proc/self/ns/"+nsType.StringLower())
+	}
+	out, err := Command(nss, "readlink", args...).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lnks := strings.Fields(string(out))
+	for i, ns := range nss {
+		if lnks[i] != ns.ID().String() {
+			t.Fatalf("expecting %s but got %s", ns.ID(), lnks[i])
+		}
+	}
+
+}
+
+func TestCommandJoinUser(t *testing.T) {
+	m := NewMask().Set(USER).Set(UTS)
+
+	c := Command(nil, "sleep", "7200")
+	c.Unshare = m
+	c.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	c.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+
+	nss := []*Namespace{}
+	for _, nsType := range m.Types() {
+		ns, err := FromPID(c.Process.Pid, nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ns.Close()
+		nss = append(nss, ns)
+	}
+
+	cmd := Command(nss, "sh", "-c", "id -u; readlink /proc/self/ns/user /proc/self/ns/uts")
+	cmd.Stdin = strings.NewReader("")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Fields(string(out))
+	if len(lines) != 3 {
+		t.Fatal("unexpected output", string(out))
+	}
+	if lines[0] != "0" {
+		t.Fatal("expecting uid 0 in joined user ns but got", lines[0])
+	}
+	for i, ns := range nss {
+		if lines[i+1] != ns.ID().String() {
+			t.Fatalf("expecting %s but got %s", ns.ID(), lines[i+1])
+		}
+	}
+
+	if err := Command(nss, "false").Run(); err == nil {
+		t.Fatal("expecting exit error")
+	}
+
+	cmd = Command(nss, "sh", "-c", "echo $$")
+	cmd.Unshare = NewMask().Set(PID)
+	out, err = cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(out)) != "1" {
+		t.Fatal("expecting pid 1 in new pid ns but got", string(out))
+	}
+
+	// the pipes see EOF once the process exits
+	cmd = Command(nss, "sh", "-c", "read x; echo $x; echo err >&2")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(stdin, "in\n"); err != nil {
+		t.Fatal(err)
+	}
+	stdin.Close()
+	outb, err := io.ReadAll(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errb, err := io.ReadAll(stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if string(outb) != "in\n" || string(errb) != "err\n" {
+		t.Fatalf("unexpected output %q and error %q", outb, errb)
+	}
+
+	cmd = Command(nss, "true")
+	cmd.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: 0, Size: 1}}
+	if err := cmd.Run(); err == nil {
+		t.Fatal("expecting error for id mappings when joining a user ns")
+	}
+}
+
+func TestCommandUnshare(t *testing.T) {
+	m := NewMask().Set(USER).Set(UTS).Set(TIME)
+
+	cmd := Command(nil, "sh", "-c", "id -u; readlink /proc/self/ns/user /proc/self/ns/uts /proc/self/ns/time")
+	cmd.Unshare = m
+	cmd.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	cmd.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Fields(string(out))
+	if lines[0] != "0" {
+		t.Fatal("expecting uid 0 in new user ns but got", lines[0])
+	}
+	for i, nsType := range []Type{USER, UTS, TIME} {
+		self, err := Self(nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines[i+1] == self.ID().String() {
+			t.Fatal("process should be in a new", nsType)
+		}
+		self.Close()
+	}
+}
@@ -0,0 +1,407 @@
+package namespace
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ProcAttr holds the attributes of a process started by StartProcess
+type ProcAttr struct {
+	// Dir is the working directory, resolved after joining Namespaces
+	Dir string
+	// Env is the environment, the caller's if nil
+	Env []string
+	// Files are the open files of the process, entry i is fd i. nil entries are closed
+	Files []*os.File
+	// Executable, if set, is executed instead of name. It is opened by the caller, so it can come from a mount
+	// namespace other than the one the process joins
+	Executable *os.File
+	// Namespaces the process joins
+	Namespaces []*Namespace
+	// Unshare has the types of new namespaces created after joining Namespaces. A new user namespace can't be
+	// given id maps before exec so USER fails with EINVAL. With a new pid namespace the process is its init
+	Unshare Mask
+}
+
+// steps of the child reported through the error pipe
+const (
+	forkSetns uintptr = iota
+	forkCreds
+	forkUnshare
+	forkClone
+	forkChdir
+	forkFds
+	forkExec
+	// not a failure, the pid of the process that execs after the second fork
+	forkPid
+)
+
+// how of rt_sigprocmask(2)
+const sigSetmask = 2
+
+// forkAttr is everything the child needs, prepared by the parent so the child doesn't allocate
+type forkAttr struct {
+	nsFds   []int
+	userFd  int
+	unshare uintptr
+	clone   bool
+	dir     *byte
+	fds     []int
+	exe     int
+	paths   []*byte
+	argv    []*byte
+	envv    []*byte
+	pipe    int
+	sigmask uint64
+	empty   byte
+	// written by the child on failure
+	fail [3]uintptr
+}
+
+// StartProcess starts the program name with argv inside attr.Namespaces, like os.StartProcess. The namespaces
+// are joined by the forked child before it execs, while it is still single threaded, so unlike Do and Set
+// user and time namespaces can be joined too. The user namespace is joined first and then, as nsenter(1) does,
+// supplementary groups are dropped and uid and gid are set to 0 in it. If name has no slash it is looked up in
+// the PATH of attr.Env after joining, inside the mount namespace of the process.
+//
+// Joining or creating a pid namespace, and creating a time namespace, only applies to the children of the one
+// doing it. The child forks once more in that case, with CLONE_PARENT so the returned process is still a child
+// of the caller, and the first child exits.
+func StartProcess(name string, argv []string, attr *ProcAttr) (*os.Process, error) {
+	if attr.Unshare.Has(USER) {
+		return nil, NewError("unshare", "", USER, unix.EINVAL)
+	}
+	nss, m := sortNamespaces(attr.Namespaces)
+	a := &forkAttr{
+		userFd:  -1,
+		unshare: attr.Unshare.Uintptr(),
+		clone:   m.Has(PID) || attr.Unshare.Has(PID) || attr.Unshare.Has(TIME),
+		exe:     -1,
+	}
+	env := attr.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	var err error
+	if attr.Dir != "" {
+		if a.dir, err = syscall.BytePtrFromString(attr.Dir); err != nil {
+			return nil, err
+		}
+	}
+	if attr.Executable != nil {
+		a.exe = int(attr.Executable.Fd())
+	} else if strings.Contains(name, "/") {
+		p, err := syscall.BytePtrFromString(name)
+		if err != nil {
+			return nil, err
+		}
+		a.paths = []*byte{p}
+	} else {
+		for _, dir := range filepath.SplitList(envPath(env)) {
+			if dir == "" {
+				dir = "."
+			}
+			p, err := syscall.BytePtrFromString(filepath.Join(dir, name))
+			if err != nil {
+				return nil, err
+			}
+			a.paths = append(a.paths, p)
+		}
+	}
+	if a.argv, err = syscall.SlicePtrFromStrings(argv); err != nil {
+		return nil, err
+	}
+	if a.envv, err = syscall.SlicePtrFromStrings(env); err != nil {
+		return nil, err
+	}
+	for _, f := range attr.Files {
+		fd := -1
+		if f != nil {
+			fd = int(f.Fd())
+		}
+		a.fds = append(a.fds, fd)
+	}
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer pr.Close()
+	a.pipe = int(pw.Fd())
+
+	var pid int
+	err = useAll(nss, "start", func(fds []uintptr) error {
+		for i, fd := range fds {
+			if nss[i].Type() == USER {
+				a.userFd = int(fd)
+				continue
+			}
+			a.nsFds = append(a.nsFds, int(fd))
+		}
+		syscall.ForkLock.Lock()
+		p, errno := startChild(a)
+		syscall.ForkLock.Unlock()
+		if errno != 0 {
+			return os.NewSyscallError("fork", errno)
+		}
+		pid = int(p)
+		return nil
+	})
+	pw.Close()
+	runtime.KeepAlive(attr)
+	if err != nil {
+		return nil, err
+	}
+
+	// the pipe is closed on exec, a record read from it is the failure of a child or the pid after a second fork.
+	// the first child exits once it forked, it is done when both ends are closed
+	var rec [3]uintptr
+	b := (*[unsafe.Sizeof(rec)]byte)(unsafe.Pointer(&rec))
+	failed := false
+	fork := pid
+	if a.clone {
+		pid = 0
+	}
+	for {
+		if _, err := io.ReadFull(pr, b[:]); err != nil {
+			break
+		}
+		if rec[0] == forkPid {
+			pid = int(rec[1])
+			continue
+		}
+		a.fail = rec
+		failed = true
+	}
+	if a.clone {
+		var ws unix.WaitStatus
+		for {
+			if _, err := unix.Wait4(fork, &ws, 0, nil); err != unix.EINTR {
+				break
+			}
+		}
+	}
+	if !failed {
+		if pid == 0 {
+			return nil, os.NewSyscallError("fork", unix.ECHILD)
+		}
+		return os.FindProcess(pid)
+	}
+	if pid != 0 {
+		if p, err := os.FindProcess(pid); err == nil {
+			p.Wait()
+		}
+	}
+	step, idx, errno := a.fail[0], a.fail[1], syscall.Errno(a.fail[2])
+	switch step {
+	case forkSetns:
+		return nil, NewError("setns", nss[idx].FileName(), nss[idx].Type(), errno)
+	case forkCreds:
+		return nil, NewError("setns", "", USER, errno)
+	case forkUnshare:
+		return nil, NewError("unshare", "", INVALID, errno)
+	case forkClone:
+		return nil, os.NewSyscallError("fork", errno)
+	case forkChdir:
+		return nil, &os.PathError{Op: "chdir", Path: attr.Dir, Err: errno}
+	case forkFds:
+		return nil, os.NewSyscallError("dup3", errno)
+	}
+	return nil, &os.PathError{Op: "fork/exec", Path: name, Err: errno}
+}
+
+// envPath returns the value of PATH in env, the one of the caller if env has none
+func envPath(env []string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(env[i], "PATH=") {
+			return env[i][len("PATH="):]
+		}
+	}
+	return os.Getenv("PATH")
+}
+
+// useAll calls fn with the file descriptors of nss, which are all kept open until fn returns
+func useAll(nss []*Namespace, op string, fn func(fds []uintptr) error) error {
+	if len(nss) == 0 {
+		return fn(nil)
+	}
+	return nss[0].use(op, func(fd uintptr) error {
+		return useAll(nss[1:], op, func(fds []uintptr) error {
+			return fn(append([]uintptr{fd}, fds...))
+		})
+	})
+}
+
+// startChild forks the process. The parent returns the pid of the child, the child never returns. All signals
+// are blocked around the fork so no handler runs in the child.
+//
+//go:norace
+func startChild(a *forkAttr) (uintptr, syscall.Errno) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	all := ^uint64(0)
+	syscall.RawSyscall6(unix.SYS_RT_SIGPROCMASK, sigSetmask, uintptr(unsafe.Pointer(&all)), uintptr(unsafe.Pointer(&a.sigmask)), 8, 0, 0)
+	pid, errno := forkAndExec(a)
+	syscall.RawSyscall6(unix.SYS_RT_SIGPROCMASK, sigSetmask, uintptr(unsafe.Pointer(&a.sigmask)), 0, 8, 0, 0)
+	return pid, errno
+}
+
+// forkAndExec is a fork(2) that runs child in the new process. The child is a copy of the calling thread only,
+// nothing it runs may allocate, grow the stack or take a lock.
+//
+//go:norace
+//go:nosplit
+func forkAndExec(a *forkAttr) (uintptr, syscall.Errno) {
+	pid, _, errno := syscall.RawSyscall6(unix.SYS_CLONE, uintptr(unix.SIGCHLD), 0, 0, 0, 0, 0)
+	if errno != 0 || pid != 0 {
+		return pid, errno
+	}
+	child(a)
+	syscall.RawSyscall(unix.SYS_WRITE, uintptr(a.pipe), uintptr(unsafe.Pointer(&a.fail)), unsafe.Sizeof(a.fail))
+	for {
+		syscall.RawSyscall(unix.SYS_EXIT_GROUP, 253, 0, 0)
+	}
+}
+
+// child joins the namespaces and execs. It only returns on failure, with a.fail set.
+//
+//go:norace
+//go:nosplit
+func child(a *forkAttr) {
+	var errno syscall.Errno
+	if a.userFd != -1 {
+		if _, _, errno = syscall.RawSyscall(unix.SYS_SETNS, uintptr(a.userFd), 0, 0); errno != 0 {
+			a.fail = [3]uintptr{forkSetns, 0, uintptr(errno)}
+			return
+		}
+		// setgroups is denied in user namespaces that have it disabled, there are none to drop then
+		if _, _, errno = syscall.RawSyscall(unix.SYS_SETGROUPS, 0, 0, 0); errno != 0 && errno != unix.EPERM {
+			a.fail = [3]uintptr{forkCreds, 0, uintptr(errno)}
+			return
+		}
+		if _, _, errno = syscall.RawSyscall(unix.SYS_SETRESGID, 0, 0, 0); errno != 0 {
+			a.fail = [3]uintptr{forkCreds, 0, uintptr(errno)}
+			return
+		}
+		if _, _, errno = syscall.RawSyscall(unix.SYS_SETRESUID, 0, 0, 0); errno != 0 {
+			a.fail = [3]uintptr{forkCreds, 0, uintptr(errno)}
+			return
+		}
+	}
+	off := uintptr(0)
+	if a.userFd != -1 {
+		off = 1
+	}
+	for i, fd := range a.nsFds {
+		if _, _, errno = syscall.RawSyscall(unix.SYS_SETNS, uintptr(fd), 0, 0); errno != 0 {
+			a.fail = [3]uintptr{forkSetns, uintptr(i) + off, uintptr(errno)}
+			return
+		}
+	}
+	if a.unshare != 0 {
+		if _, _, errno = syscall.RawSyscall(unix.SYS_UNSHARE, a.unshare, 0, 0); errno != 0 {
+			a.fail = [3]uintptr{forkUnshare, 0, uintptr(errno)}
+			return
+		}
+	}
+	if a.clone {
+		// the first child reports the pid and exits, the second is inside the pid and time namespaces
+		pid, _, errno := syscall.RawSyscall6(unix.SYS_CLONE, unix.CLONE_PARENT|uintptr(unix.SIGCHLD), 0, 0, 0, 0, 0)
+		if errno != 0 {
+			a.fail = [3]uintptr{forkClone, 0, uintptr(errno)}
+			return
+		}
+		if pid != 0 {
+			a.fail = [3]uintptr{forkPid, pid, 0}
+			return
+		}
+	}
+	if a.dir != nil {
+		if _, _, errno = syscall.RawSyscall(unix.SYS_CHDIR, uintptr(unsafe.Pointer(a.dir)), 0, 0); errno != 0 {
+			a.fail = [3]uintptr{forkChdir, 0, uintptr(errno)}
+			return
+		}
+	}
+
+	// move every fd that is still needed above the ones being set up, then set them up
+	next := len(a.fds)
+	for _, fd := range a.fds {
+		if fd >= next {
+			next = fd + 1
+		}
+	}
+	if a.pipe >= next {
+		next = a.pipe + 1
+	}
+	if a.exe >= next {
+		next = a.exe + 1
+	}
+	if a.pipe < len(a.fds) {
+		if _, _, errno = syscall.RawSyscall(unix.SYS_DUP3, uintptr(a.pipe), uintptr(next), unix.O_CLOEXEC); errno != 0 {
+			a.fail = [3]uintptr{forkFds, 0, uintptr(errno)}
+			return
+		}
+		a.pipe = next
+		next++
+	}
+	if a.exe != -1 && a.exe < len(a.fds) {
+		if _, _, errno = syscall.RawSyscall(unix.SYS_DUP3, uintptr(a.exe), uintptr(next), unix.O_CLOEXEC); errno != 0 {
+			a.fail = [3]uintptr{forkFds, 0, uintptr(errno)}
+			return
+		}
+		a.exe = next
+		next++
+	}
+	for i, fd := range a.fds {
+		if fd != -1 && fd < i {
+			if _, _, errno = syscall.RawSyscall(unix.SYS_DUP3, uintptr(fd), uintptr(next), unix.O_CLOEXEC); errno != 0 {
+				a.fail = [3]uintptr{forkFds, 0, uintptr(errno)}
+				return
+			}
+			a.fds[i] = next
+			next++
+		}
+	}
+	for i, fd := range a.fds {
+		switch {
+		case fd == -1:
+			syscall.RawSyscall(unix.SYS_CLOSE, uintptr(i), 0, 0)
+		case fd == i:
+			_, _, errno = syscall.RawSyscall(unix.SYS_FCNTL, uintptr(i), unix.F_SETFD, 0)
+		default:
+			_, _, errno = syscall.RawSyscall(unix.SYS_DUP3, uintptr(fd), uintptr(i), 0)
+		}
+		if errno != 0 {
+			a.fail = [3]uintptr{forkFds, 0, uintptr(errno)}
+			return
+		}
+	}
+
+	syscall.RawSyscall6(unix.SYS_RT_SIGPROCMASK, sigSetmask, uintptr(unsafe.Pointer(&a.sigmask)), 0, 8, 0, 0)
+	argv := uintptr(unsafe.Pointer(&a.argv[0]))
+	envv := uintptr(unsafe.Pointer(&a.envv[0]))
+	if a.exe != -1 {
+		_, _, errno = syscall.RawSyscall6(unix.SYS_EXECVEAT, uintptr(a.exe), uintptr(unsafe.Pointer(&a.empty)), argv, envv, unix.AT_EMPTY_PATH, 0)
+		a.fail = [3]uintptr{forkExec, 0, uintptr(errno)}
+		return
+	}
+	// try PATH in order like execvp(3), a permission error is only reported if nothing else is found
+	a.fail = [3]uintptr{forkExec, 0, uintptr(unix.ENOENT)}
+	for _, p := range a.paths {
+		_, _, errno = syscall.RawSyscall(unix.SYS_EXECVE, uintptr(unsafe.Pointer(p)), argv, envv)
+		switch errno {
+		case unix.ENOENT, unix.ENOTDIR:
+		case unix.EACCES:
+			a.fail[2] = uintptr(errno)
+		default:
+			a.fail[2] = uintptr(errno)
+			return
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package namespace
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestStartProcess(t *testing.T) {
+	m := NewMask().Set(USER).Set(NET).Set(UTS).Set(MNT)
+
+	c := exec.Command("sleep", "7200")
+	c.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  m.CloneFlags(),
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+
+	nss := []*Namespace{}
+	args := []string{}
+	for _, nsType := range m.Types() {
+		ns, err := FromPID(c.Process.Pid, nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ns.Close()
+		nss = append(nss, ns)
+		args = append(args, "/proc/self/ns/"+nsType.StringLower())
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	in, stdin, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := StartProcess("sh", []string{"sh", "-c", "id -u; echo $$; readlink " + strings.Join(args, " ") + "; read x || true"}, &ProcAttr{
+		Files:      []*os.File{in, w, os.Stderr},
+		Namespaces: nss,
+		Unshare:    NewMask().Set(PID).Set(TIME),
+	})
+	in.Close()
+	w.Close()
+	if err != nil {
+		stdin.Close()
+		t.Fatal(err)
+	}
+	defer p.Wait()
+	defer stdin.Close()
+
+	lines := []string{}
+	sc := bufio.NewScanner(r)
+	for len(lines) < len(nss)+2 && sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if len(lines) != len(nss)+2 {
+		t.Fatal("unexpected output", lines)
+	}
+	if lines[0] != "0" {
+		t.Fatal("expecting uid 0 in joined user ns but got", lines[0])
+	}
+	if lines[1] != "1" {
+		t.Fatal("expecting pid 1 in new pid ns but got", lines[1])
+	}
+	for i, ns := range nss {
+		if lines[i+2] != ns.ID().String() {
+			t.Fatalf("expecting %s but got %s", ns.ID(), lines[i+2])
+		}
+	}
+
+	// the process itself is in the new namespaces, not only its children
+	for _, nsType := range []Type{PID, TIME} {
+		self, err := Self(nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer self.Close()
+		ns, err := FromPID(p.Pid, nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ns.Close()
+		if ns.Equal(self) {
+			t.Fatalf("expecting a new %s ns", nsType.StringLower())
+		}
+	}
+
+	stdin.Close()
+	if st, err := p.Wait(); err != nil || !st.Success() {
+		t.Fatal("process failed", st, err)
+	}
+}
+
+func TestStartProcessError(t *testing.T) {
+	_, err := StartProcess("namespace-no-such-command", []string{"namespace-no-such-command"}, &ProcAttr{})
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("expecting ErrNotExist but got", err)
+	}
+
+	_, err = StartProcess("true", []string{"true"}, &ProcAttr{Unshare: NewMask().Set(USER)})
+	if !errors.Is(err, syscall.EINVAL) {
+		t.Fatal("expecting EINVAL but got", err)
+	}
+
+	usr, err := Self(USER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usr.Close()
+	_, err = StartProcess("true", []string{"true"}, &ProcAttr{Namespaces: []*Namespace{usr}})
+	if !errors.Is(err, ErrClosed) {
+		t.Fatal("expecting ErrClosed but got", err)
+	}
+}
@@ -0,0 +1,517 @@
+// Package forward proxies tcp connections and udp datagrams from an address in one network namespace to an
+// address in another.
+package forward
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/thegrumpylion/namespace"
+)
+
+// DefaultUDPTimeout is the idle time after which a udp session is closed if Config.UDPTimeout is not set
+const DefaultUDPTimeout = time.Minute
+
+// DefaultDrainTimeout is how long Serve waits for open connections once stopped if Config.DrainTimeout is
+// not set
+const DefaultDrainTimeout = 30 * time.Second
+
+// ErrServing returned when calling Serve more than once
+var ErrServing = errors.New("forwarder already serving")
+
+// Config of a Forwarder
+type Config struct {
+	// Network is one of tcp, tcp4, tcp6, udp, udp4 or udp6
+	Network string
+	// ListenNS is the network namespace to listen in. nil for the caller's
+	ListenNS *namespace.Namespace
+	// ListenAddr is the local address to listen on e.g. 127.0.0.1:8080
+	ListenAddr string
+	// TargetNS is the network namespace to connect from. nil for the caller's
+	TargetNS *namespace.Namespace
+	// TargetAddr is the address connections and datagrams are forwarded to
+	TargetAddr string
+	// MaxConns limits the number of concurrent tcp connections or udp sessions, 0 for no limit. Connections
+	// over the limit are closed right away, datagrams from new udp clients are dropped. The target is only
+	// dialed for connections and sessions within the limit.
+	MaxConns int
+	// UDPTimeout is the idle time after which a udp session is closed. DefaultUDPTimeout if 0
+	UDPTimeout time.Duration
+	// DrainTimeout is how long Serve waits for open connections and udp sessions to finish once its context
+	// is done before closing them. DefaultDrainTimeout if 0
+	DrainTimeout time.Duration
+	// OnClose, if set, is called with the final stats of every connection or udp session
+	OnClose func(ConnStats)
+}
+
+// ConnStats are the counters of a forwarded tcp connection or udp session
+type ConnStats struct {
+	// Client is the remote address of the connection in the listen namespace
+	Client net.Addr
+	// Started is when the connection was accepted or the first datagram received
+	Started time.Time
+	// Sent is the number of bytes forwarded from the client to the target
+	Sent uint64
+	// Received is the number of bytes forwarded from the target to the client
+	Received uint64
+}
+
+// Forwarder forwards connections or datagrams between two network namespaces
+type Forwarder struct {
+	cfg     Config
+	udp     bool
+	ln      net.Listener
+	pc      net.PacketConn
+	mu      sync.Mutex
+	conns   map[*conn]struct{}
+	serving bool
+	wg      sync.WaitGroup
+}
+
+// udpQueue is the number of datagrams from a udp client buffered for its session, more are dropped
+const udpQueue = 64
+
+// conn is a forwarded tcp connection or udp session
+type conn struct {
+	client   net.Addr
+	started  time.Time
+	sent     uint64
+	received uint64
+	// src is the accepted tcp connection, nil for udp
+	src net.Conn
+	// last is the unix nano time of the last udp datagram
+	last int64
+	// in are the datagrams from the udp client not yet sent to the target
+	in chan []byte
+	// done is closed with the conn
+	done chan struct{}
+
+	mu     sync.Mutex
+	target net.Conn
+	closed bool
+}
+
+func (c *conn) stats() ConnStats {
+	return ConnStats{
+		Client:   c.client,
+		Started:  c.started,
+		Sent:     atomic.LoadUint64(&c.sent),
+		Received: atomic.LoadUint64(&c.received),
+	}
+}
+
+// setTarget sets the connection to the target, dialed after c was added. It is closed instead and false
+// returned if c was closed meanwhile.
+func (c *conn) setTarget(target net.Conn) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		target.Close()
+		return false
+	}
+	c.target = target
+	return true
+}
+
+func (c *conn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.done)
+	if c.target != nil {
+		c.target.Close()
+	}
+	if c.src != nil {
+		c.src.Close()
+	}
+}
+
+// New returns a Forwarder listening on cfg.ListenAddr in cfg.ListenNS. Nothing is forwarded until Serve is
+// called.
+func New(cfg Config) (*Forwarder, error) {
+	if cfg.UDPTimeout == 0 {
+		cfg.UDPTimeout = DefaultUDPTimeout
+	}
+	if cfg.DrainTimeout == 0 {
+		cfg.DrainTimeout = DefaultDrainTimeout
+	}
+	f := &Forwarder{
+		cfg:   cfg,
+		udp:   strings.HasPrefix(cfg.Network, "udp"),
+		conns: map[*conn]struct{}{},
+	}
+	var err error
+	switch {
+	case f.udp:
+		if cfg.ListenNS == nil {
+			f.pc, err = net.ListenPacket(cfg.Network, cfg.ListenAddr)
+		} else {
+			f.pc, err = namespace.ListenPacket(cfg.ListenNS, cfg.Network, cfg.ListenAddr)
+		}
+	case strings.HasPrefix(cfg.Network, "tcp"):
+		if cfg.ListenNS == nil {
+			f.ln, err = net.Listen(cfg.Network, cfg.ListenAddr)
+		} else {
+			f.ln, err = namespace.Listen(cfg.ListenNS, cfg.Network, cfg.ListenAddr)
+		}
+	default:
+		err = net.UnknownNetworkError(cfg.Network)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Addr returns the address the forwarder listens on
+func (f *Forwarder) Addr() net.Addr {
+	if f.udp {
+		return f.pc.LocalAddr()
+	}
+	return f.ln.Addr()
+}
+
+// Conns returns the stats of the open connections or udp sessions, oldest first
+func (f *Forwarder) Conns() []ConnStats {
+	f.mu.Lock()
+	out := make([]ConnStats, 0, len(f.conns))
+	for c := range f.conns {
+		out = append(out, c.stats())
+	}
+	f.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Started.Before(out[j].Started)
+	})
+	return out
+}
+
+// Serve forwards until ctx is done. It then stops accepting connections and udp datagrams and waits up to
+// DrainTimeout for the open connections and udp sessions to finish before closing them. A udp session
+// finishes once idle for UDPTimeout. It returns ctx.Err(), or the error that stopped the listener in which
+// case the open connections are closed right away.
+func (f *Forwarder) Serve(ctx context.Context) error {
+	f.mu.Lock()
+	if f.serving {
+		f.mu.Unlock()
+		return ErrServing
+	}
+	f.serving = true
+	f.mu.Unlock()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		// the packet conn is still needed to send the replies of the draining sessions, unblock ReadFrom
+		// instead of closing it
+		if f.udp {
+			f.pc.SetReadDeadline(time.Now())
+		} else {
+			f.ln.Close()
+		}
+	}()
+
+	// the connections outlive ctx while draining, they are only canceled when closed
+	hctx, hcancel := context.WithCancel(context.Background())
+	defer hcancel()
+	var err error
+	if f.udp {
+		err = f.serveUDP(hctx)
+	} else {
+		err = f.serveTCP(hctx)
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+		f.drain()
+	}
+	hcancel()
+	f.closeConns()
+	f.wg.Wait()
+	if f.udp {
+		f.pc.Close()
+	}
+	return err
+}
+
+// drain waits up to DrainTimeout for the open connections and udp sessions to finish
+func (f *Forwarder) drain() {
+	done := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(done)
+	}()
+	t := time.NewTimer(f.cfg.DrainTimeout)
+	defer t.Stop()
+	select {
+	case <-done:
+	case <-t.C:
+	}
+}
+
+func (f *Forwarder) closeConns() {
+	f.mu.Lock()
+	for c := range f.conns {
+		c.close()
+	}
+	f.mu.Unlock()
+}
+
+func (f *Forwarder) dial(ctx context.Context) (net.Conn, error) {
+	if f.cfg.TargetNS == nil {
+		d := &net.Dialer{}
+		return d.DialContext(ctx, f.cfg.Network, f.cfg.TargetAddr)
+	}
+	return namespace.DialContext(ctx, f.cfg.TargetNS, f.cfg.Network, f.cfg.TargetAddr)
+}
+
+// add registers c unless MaxConns is reached
+func (f *Forwarder) add(c *conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.cfg.MaxConns > 0 && len(f.conns) >= f.cfg.MaxConns {
+		return false
+	}
+	f.conns[c] = struct{}{}
+	f.wg.Add(1)
+	return true
+}
+
+func (f *Forwarder) remove(c *conn) {
+	f.mu.Lock()
+	delete(f.conns, c)
+	f.mu.Unlock()
+	c.close()
+	if f.cfg.OnClose != nil {
+		f.cfg.OnClose(c.stats())
+	}
+	f.wg.Done()
+}
+
+func (f *Forwarder) serveTCP(ctx context.Context) error {
+	var delay backoff
+	for {
+		src, err := f.ln.Accept()
+		if err != nil {
+			if retryable(err) {
+				delay.wait(ctx, err)
+				continue
+			}
+			return err
+		}
+		delay.reset()
+		c := &conn{
+			client:  src.RemoteAddr(),
+			started: time.Now(),
+			src:     src,
+			done:    make(chan struct{}),
+		}
+		if !f.add(c) {
+			src.Close()
+			continue
+		}
+		go f.handleTCP(ctx, c)
+	}
+}
+
+// handleTCP dials the target for c and forwards between them
+func (f *Forwarder) handleTCP(ctx context.Context, c *conn) {
+	target, err := f.dial(ctx)
+	if err != nil || !c.setTarget(target) {
+		f.remove(c)
+		return
+	}
+	f.pipeTCP(c)
+}
+
+func (f *Forwarder) pipeTCP(c *conn) {
+	defer f.remove(c)
+	done := make(chan struct{})
+	go func() {
+		copyCount(c.target, c.src, &c.sent)
+		closeWrite(c.target)
+		close(done)
+	}()
+	copyCount(c.src, c.target, &c.received)
+	closeWrite(c.src)
+	<-done
+}
+
+// closeWrite shuts down the writing side of a tcp connection so the peer sees EOF
+func closeWrite(c net.Conn) {
+	if tc, ok := c.(interface{ CloseWrite() error }); ok {
+		tc.CloseWrite()
+	}
+}
+
+func copyCount(dst io.Writer, src io.Reader, n *uint64) {
+	buf := make([]byte, 32*1024)
+	for {
+		nr, err := src.Read(buf)
+		if nr > 0 {
+			nw, werr := dst.Write(buf[:nr])
+			atomic.AddUint64(n, uint64(nw))
+			if werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (f *Forwarder) serveUDP(ctx context.Context) error {
+	sessions := map[string]*conn{}
+	var smu sync.Mutex
+	buf := make([]byte, 64*1024)
+	var delay backoff
+	for {
+		n, addr, err := f.pc.ReadFrom(buf)
+		if err != nil {
+			if retryable(err) {
+				delay.wait(ctx, err)
+				continue
+			}
+			return err
+		}
+		delay.reset()
+		key := addr.String()
+		// the lock is held until the datagram is queued, a session is dropped under it before it is closed
+		smu.Lock()
+		c, ok := sessions[key]
+		if !ok {
+			c = &conn{
+				client:  addr,
+				started: time.Now(),
+				last:    time.Now().UnixNano(),
+				in:      make(chan []byte, udpQueue),
+				done:    make(chan struct{}),
+			}
+			if !f.add(c) {
+				smu.Unlock()
+				continue
+			}
+			sessions[key] = c
+			go f.handleUDP(ctx, c, func() {
+				smu.Lock()
+				delete(sessions, key)
+				smu.Unlock()
+			})
+		}
+		atomic.StoreInt64(&c.last, time.Now().UnixNano())
+		select {
+		case c.in <- append([]byte(nil), buf[:n]...):
+		default:
+		}
+		smu.Unlock()
+	}
+}
+
+// retryable is true for errors of Accept and ReadFrom that don't stop the listener
+func retryable(err error) bool {
+	return exhausted(err) || errors.Is(err, syscall.ECONNABORTED)
+}
+
+// exhausted is true if err is from running out of file descriptors
+func exhausted(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
+
+const (
+	minBackoff = 5 * time.Millisecond
+	maxBackoff = time.Second
+)
+
+// backoff is the delay before retrying Accept or ReadFrom after running out of file descriptors, same as
+// net/http Server.Serve. It doubles from minBackoff up to maxBackoff and starts over after a success.
+type backoff struct {
+	d time.Duration
+}
+
+// wait sleeps for the next delay if err is exhausted, or until ctx is done
+func (b *backoff) wait(ctx context.Context, err error) {
+	if !exhausted(err) {
+		return
+	}
+	if b.d == 0 {
+		b.d = minBackoff
+	} else {
+		b.d *= 2
+	}
+	if b.d > maxBackoff {
+		b.d = maxBackoff
+	}
+	t := time.NewTimer(b.d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+}
+
+func (b *backoff) reset() {
+	b.d = 0
+}
+
+// handleUDP dials the target for the session c, sends it the datagrams of the client and forwards the replies,
+// and drops it with drop once it is idle
+func (f *Forwarder) handleUDP(ctx context.Context, c *conn, drop func()) {
+	defer func() {
+		drop()
+		f.remove(c)
+	}()
+	target, err := f.dial(ctx)
+	if err != nil || !c.setTarget(target) {
+		return
+	}
+	go func() {
+		for {
+			select {
+			case b := <-c.in:
+				if nw, err := target.Write(b); err == nil {
+					atomic.AddUint64(&c.sent, uint64(nw))
+				}
+			case <-c.done:
+				return
+			}
+		}
+	}()
+	f.pipeUDP(c)
+}
+
+// pipeUDP sends the replies of the target back to the client until the session is idle for UDPTimeout
+func (f *Forwarder) pipeUDP(c *conn) {
+	buf := make([]byte, 64*1024)
+	for {
+		last := time.Unix(0, atomic.LoadInt64(&c.last))
+		c.target.SetReadDeadline(last.Add(f.cfg.UDPTimeout))
+		n, err := c.target.Read(buf)
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				if time.Since(time.Unix(0, atomic.LoadInt64(&c.last))) < f.cfg.UDPTimeout {
+					continue
+				}
+			}
+			return
+		}
+		atomic.StoreInt64(&c.last, time.Now().UnixNano())
+		if nw, err := f.pc.WriteTo(buf[:n], c.client); err == nil {
+			atomic.AddUint64(&c.received, uint64(nw))
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package forward
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/thegrumpylion/namespace"
+)
+
+// waitConns polls the stats of f until there is one connection with the expected counters. The counters are
+// updated after the data is written so the client can see it first
+func waitConns(t *testing.T, f *Forwarder, sent, received uint64) {
+	var conns []ConnStats
+	for i := 0; i < 100; i++ {
+		conns = f.Conns()
+		if len(conns) == 1 && conns[0].Sent == sent && conns[0].Received == received {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("unexpected stats %+v", conns)
+}
+
+func TestForwardTCP(t *testing.T) {
+	ns, err := namespace.NewNetNS(namespace.NetNSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+
+	l, err := namespace.Listen(ns, "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	var accepted int32
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&accepted, 1)
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+
+	closed := make(chan ConnStats, 1)
+	f, err := New(Config{
+		Network:    "tcp",
+		ListenAddr: "127.0.0.1:0",
+		TargetNS:   ns,
+		TargetAddr: l.Addr().String(),
+		MaxConns:   1,
+		OnClose: func(s ConnStats) {
+			closed <- s
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- f.Serve(ctx)
+	}()
+
+	c, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatal("expecting hello but got", string(buf))
+	}
+	waitConns(t, f, 5, 5)
+
+	// over the limit
+	c2, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	c2.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c2.Read(buf); err != io.EOF {
+		t.Fatal("expecting EOF over MaxConns but got", err)
+	}
+	if n := atomic.LoadInt32(&accepted); n != 1 {
+		t.Fatal("expecting the target dialed only within MaxConns but it accepted", n)
+	}
+
+	// stops accepting but the open connection is drained
+	cancel()
+	for i := 0; i < 100; i++ {
+		if _, err = net.Dial("tcp", f.Addr().String()); err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err == nil {
+		t.Fatal("expecting listener to be closed")
+	}
+	if _, err := c.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(c, buf); err != nil {
+		t.Fatal("expecting open connection to be forwarded while draining but got", err)
+	}
+	select {
+	case err := <-served:
+		t.Fatal("Serve returned before the open connection was done", err)
+	default:
+	}
+	c.Close()
+	if err := <-served; err != context.Canceled {
+		t.Fatal("expecting context.Canceled but got", err)
+	}
+	s := <-closed
+	if s.Sent != 10 || s.Received != 10 {
+		t.Fatalf("unexpected final stats %+v", s)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(c, c)
+				c.Close()
+			}()
+		}
+	}()
+
+	f, err := New(Config{
+		Network:      "tcp",
+		ListenAddr:   "127.0.0.1:0",
+		TargetAddr:   l.Addr().String(),
+		DrainTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- f.Serve(ctx)
+	}()
+
+	c, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	waitConns(t, f, 0, 0)
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != context.Canceled {
+			t.Fatal("expecting context.Canceled but got", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("open connection was not closed after DrainTimeout")
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatal("expecting EOF after DrainTimeout but got", err)
+	}
+}
+
+func TestForwardUDP(t *testing.T) {
+	ns, err := namespace.NewNetNS(namespace.NetNSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+
+	pc, err := namespace.ListenPacket(ns, "udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	f, err := New(Config{
+		Network:    "udp",
+		ListenNS:   ns,
+		ListenAddr: "127.0.0.1:0",
+		TargetNS:   ns,
+		TargetAddr: pc.LocalAddr().String(),
+		UDPTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go f.Serve(ctx)
+
+	c, err := namespace.DialContext(ctx, ns, "udp", f.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4)
+	if _, err := c.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "ping" {
+		t.Fatal("expecting ping but got", string(buf))
+	}
+	waitConns(t, f, 4, 4)
+
+	// the session is closed once idle
+	time.Sleep(500 * time.Millisecond)
+	if conns := f.Conns(); len(conns) != 0 {
+		t.Fatalf("expecting idle session to be closed but got %+v", conns)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	// a done ctx so wait doesn't sleep
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var b backoff
+	b.wait(ctx, syscall.ECONNABORTED)
+	if b.d != 0 {
+		t.Fatal("expecting no delay for ECONNABORTED but got", b.d)
+	}
+	want := minBackoff
+	for i := 0; i < 10; i++ {
+		b.wait(ctx, &net.OpError{Op: "accept", Err: os.NewSyscallError("accept4", syscall.EMFILE)})
+		if b.d != want {
+			t.Fatalf("expecting delay %s but got %s", want, b.d)
+		}
+		if want *= 2; want > maxBackoff {
+			want = maxBackoff
+		}
+	}
+	b.reset()
+	b.wait(ctx, syscall.ENFILE)
+	if b.d != minBackoff {
+		t.Fatal("expecting delay to start over after reset but got", b.d)
+	}
+}
@@ -1,5 +1,5 @@
 module github.com/thegrumpylion/namespace
 
-go 1.12
+go 1.13
 
 require golang.org/x/sys v0.0.0-20190922100055-0a153f010e69
@@ -0,0 +1,136 @@
+package namespace
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ID identifies a namespace. It is comparable and can be used as a map key as long as Dev is either
+// always or never set for the keys.
+type ID struct {
+	Type Type
+	Dev  Dev
+	Ino  uint64
+}
+
+// ID returns the identity of the namespace. Still valid after the namespace has been closed.
+func (ns *Namespace) ID() ID {
+	return ID{
+		Type: ns.Type(),
+		Dev:  ns.Dev(),
+		Ino:  ns.Ino(),
+	}
+}
+
+// Equal is true if both namespaces are the same
+func (ns *Namespace) Equal(other *Namespace) bool {
+	return ns.ID().Equal(other.ID())
+}
+
+// Equal is true if both ids refer to the same namespace. Dev is only compared when set in both since
+// the kernel string format doesn't have it
+func (id ID) Equal(other ID) bool {
+	if id.Type != other.Type || id.Ino != other.Ino {
+		return false
+	}
+	if id.Dev == (Dev{}) || other.Dev == (Dev{}) {
+		return true
+	}
+	return id.Dev == other.Dev
+}
+
+// String returns the id in the format of the procfs ns symlinks e.g. net:[4026531992]
+func (id ID) String() string {
+	return id.Type.StringLower() + ":[" + strconv.FormatUint(id.Ino, 10) + "]"
+}
+
+// MarshalText returns the id as String does with @major:minor of Dev appended if set
+func (id ID) MarshalText() ([]byte, error) {
+	if id.Type.String() == "" {
+		return nil, fmt.Errorf("invalid namespace type %d", id.Type)
+	}
+	s := id.String()
+	if id.Dev != (Dev{}) {
+		s += "@" + strconv.FormatUint(uint64(id.Dev.Major), 10) + ":" + strconv.FormatUint(uint64(id.Dev.Minor), 10)
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalText sets the id from the output of MarshalText or String
+func (id *ID) UnmarshalText(b []byte) error {
+	out, err := ParseID(string(b))
+	if err != nil {
+		return err
+	}
+	*id = out
+	return nil
+}
+
+// ParseID returns the id for the format of the procfs ns symlinks e.g. net:[4026531992]. The optional
+// @major:minor suffix written by MarshalText sets Dev
+func ParseID(s string) (ID, error) {
+	id := ID{}
+	invalid := func() (ID, error) {
+		return ID{}, fmt.Errorf("invalid namespace id %q", s)
+	}
+	str := s
+	if i := strings.LastIndexByte(str, '@'); i >= 0 {
+		dev := strings.SplitN(str[i+1:], ":", 2)
+		if len(dev) != 2 {
+			return invalid()
+		}
+		maj, err := strconv.ParseUint(dev[0], 10, 32)
+		if err != nil {
+			return invalid()
+		}
+		min, err := strconv.ParseUint(dev[1], 10, 32)
+		if err != nil {
+			return invalid()
+		}
+		id.Dev = Dev{
+			Major: uint32(maj),
+			Minor: uint32(min),
+		}
+		str = str[:i]
+	}
+	i := strings.IndexByte(str, ':')
+	if i < 0 || !strings.HasPrefix(str[i+1:], "[") || !strings.HasSuffix(str, "]") {
+		return invalid()
+	}
+	// TypeFromString is case insensitive but the kernel format is always lower case
+	if str[:i] != strings.ToLower(str[:i]) {
+		return invalid()
+	}
+	id.Type = TypeFromString(str[:i])
+	if id.Type == INVALID {
+		return invalid()
+	}
+	ino, err := strconv.ParseUint(str[i+2:len(str)-1], 10, 64)
+	if err != nil {
+		return invalid()
+	}
+	id.Ino = ino
+	return id, nil
+}
+
+// statID returns the id of the namespace of type t at path without opening it
+func statID(path string, t Type) (ID, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return ID{}, err
+	}
+	stat := st.Sys().(*syscall.Stat_t)
+	return ID{
+		Type: t,
+		Dev: Dev{
+			Major: unix.Major(stat.Dev),
+			Minor: unix.Minor(stat.Dev),
+		},
+		Ino: stat.Ino,
+	}, nil
+}
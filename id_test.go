@@ -0,0 +1,68 @@
+package namespace
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestID(t *testing.T) {
+	for _, nsType := range Types() {
+		ns, err := Self(nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ns.Close()
+
+		lnk, err := os.Readlink(filepath.Join(PROCFSPath, "self", "ns", nsType.StringLower()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ns.ID().String() != lnk {
+			t.Fatalf("expecting %s but got %s", lnk, ns.ID())
+		}
+
+		id, err := ParseID(lnk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !id.Equal(ns.ID()) {
+			t.Fatalf("%s should be equal to %s", id, ns.ID())
+		}
+
+		dup, err := ns.Dup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !dup.Equal(ns) || dup.ID() != ns.ID() {
+			t.Fatal("dup should be equal to ns", ns.ID())
+		}
+		dup.Close()
+
+		b, err := json.Marshal(map[string]ID{"ns": ns.ID()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := map[string]ID{}
+		if err := json.Unmarshal(b, &out); err != nil {
+			t.Fatal(err)
+		}
+		if out["ns"] != ns.ID() {
+			t.Fatalf("expecting %+v after json round trip but got %+v", ns.ID(), out["ns"])
+		}
+	}
+
+	for _, s := range []string{"", "net", "net:[]", "net:[12", "NET:[1]", "foo:[1]", "net:[1]@1", "net:[1]@x:1"} {
+		if _, err := ParseID(s); err == nil {
+			t.Fatalf("parsing %q should have failed", s)
+		}
+	}
+
+	if (ID{Type: NET, Ino: 1}).Equal(ID{Type: UTS, Ino: 1}) {
+		t.Fatal("ids of different type should not be equal")
+	}
+	if (ID{Type: NET, Ino: 1, Dev: Dev{0, 4}}).Equal(ID{Type: NET, Ino: 1, Dev: Dev{0, 5}}) {
+		t.Fatal("ids of different dev should not be equal")
+	}
+}
@@ -0,0 +1,295 @@
+package namespace
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// MaxIDMappings is the number of lines the kernel accepts in uid_map and gid_map
+const MaxIDMappings = 340
+
+// ErrInvalidIDMap returned by IDMap.Validate
+var ErrInvalidIDMap = errors.New("invalid id map")
+
+// ErrUnmappedID returned when translating an id that has no mapping
+var ErrUnmappedID = errors.New("id not mapped")
+
+// ErrNoMember returned when a namespace has no member process to read its state from
+var ErrNoMember = errors.New("ns has no member process")
+
+// IDMapping maps Size ids of a user namespace starting at ContainerID to the ids of its parent starting at HostID
+type IDMapping struct {
+	ContainerID uint32
+	HostID      uint32
+	Size        uint32
+}
+
+// IDMap is the content of uid_map or gid_map
+type IDMap []IDMapping
+
+// ParseIDMap returns the map for the kernel format of uid_map and gid_map, a line of container id, host id and
+// size per mapping
+func ParseIDMap(s string) (IDMap, error) {
+	m := IDMap{}
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) != 3 {
+			return nil, fmt.Errorf("malformed id map line %q", sc.Text())
+		}
+		v := [3]uint32{}
+		for i := range f {
+			n, err := strconv.ParseUint(f[i], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("malformed id map line %q", sc.Text())
+			}
+			v[i] = uint32(n)
+		}
+		m = append(m, IDMapping{
+			ContainerID: v[0],
+			HostID:      v[1],
+			Size:        v[2],
+		})
+	}
+	return m, sc.Err()
+}
+
+// String returns the map in the kernel format, ready to be written
+func (m IDMap) String() string {
+	s := ""
+	for _, e := range m {
+		s += strconv.FormatUint(uint64(e.ContainerID), 10) + " " + strconv.FormatUint(uint64(e.HostID), 10) + " " +
+			strconv.FormatUint(uint64(e.Size), 10) + "\n"
+	}
+	return s
+}
+
+// Validate checks the map against the rules of the kernel: at least one and at most MaxIDMappings mappings,
+// none empty or wrapping around and no overlapping ranges on either side
+func (m IDMap) Validate() error {
+	if len(m) == 0 || len(m) > MaxIDMappings {
+		return fmt.Errorf("%w: %d mappings", ErrInvalidIDMap, len(m))
+	}
+	for _, e := range m {
+		if e.Size == 0 {
+			return fmt.Errorf("%w: empty mapping %v", ErrInvalidIDMap, e)
+		}
+		// the last id of a range can't be -1 either, it is the invalid id
+		if uint64(e.ContainerID)+uint64(e.Size) > 1<<32-1 || uint64(e.HostID)+uint64(e.Size) > 1<<32-1 {
+			return fmt.Errorf("%w: mapping %v out of range", ErrInvalidIDMap, e)
+		}
+	}
+	for _, side := range []func(IDMapping) uint32{
+		func(e IDMapping) uint32 { return e.ContainerID },
+		func(e IDMapping) uint32 { return e.HostID },
+	} {
+		s := append(IDMap{}, m...)
+		sort.Slice(s, func(i, j int) bool {
+			return side(s[i]) < side(s[j])
+		})
+		for i := 1; i < len(s); i++ {
+			if uint64(side(s[i-1]))+uint64(s[i-1].Size) > uint64(side(s[i])) {
+				return fmt.Errorf("%w: mappings %v and %v overlap", ErrInvalidIDMap, s[i-1], s[i])
+			}
+		}
+	}
+	return nil
+}
+
+// ToParent returns the id in the parent user namespace for id in the namespace of the map
+func (m IDMap) ToParent(id uint32) (uint32, bool) {
+	for _, e := range m {
+		if id >= e.ContainerID && id-e.ContainerID < e.Size {
+			return e.HostID + id - e.ContainerID, true
+		}
+	}
+	return 0, false
+}
+
+// FromParent returns the id in the namespace of the map for id in the parent user namespace
+func (m IDMap) FromParent(id uint32) (uint32, bool) {
+	for _, e := range m {
+		if id >= e.HostID && id-e.HostID < e.Size {
+			return e.ContainerID + id - e.HostID, true
+		}
+	}
+	return 0, false
+}
+
+// SysProcIDMap returns the map for syscall.SysProcAttr and Cmd
+func (m IDMap) SysProcIDMap() []syscall.SysProcIDMap {
+	out := make([]syscall.SysProcIDMap, 0, len(m))
+	for _, e := range m {
+		out = append(out, syscall.SysProcIDMap{
+			ContainerID: int(e.ContainerID),
+			HostID:      int(e.HostID),
+			Size:        int(e.Size),
+		})
+	}
+	return out
+}
+
+// ReadIDMaps returns the uid and gid maps of the user namespace of pid. The host ids are relative to the
+// parent namespace if the caller is in that user namespace or its parent, otherwise to the caller's. A range the
+// caller's namespace has no ids for shows up as 4294967295 and fails with ErrUnmappedID. Needs procfs.
+func ReadIDMaps(pid int) (uid IDMap, gid IDMap, err error) {
+	if uid, err = readIDMap(pid, "uid_map"); err != nil {
+		return nil, nil, err
+	}
+	if gid, err = readIDMap(pid, "gid_map"); err != nil {
+		return nil, nil, err
+	}
+	return uid, gid, nil
+}
+
+func readIDMap(pid int, name string) (IDMap, error) {
+	path := filepath.Join(PROCFSPath, strconv.Itoa(pid), name)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ParseIDMap(string(b))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range m {
+		if e.HostID == 1<<32-1 {
+			return nil, NewError("read", path, USER, ErrUnmappedID)
+		}
+	}
+	return m, nil
+}
+
+// WriteIDMaps validates and writes the uid and gid maps of the user namespace of pid, either can be nil to
+// leave it unset. Each map can be written only once. A caller without CAP_SETGID in the parent namespace has
+// to deny setgroups with WriteSetgroups before writing the gid map. Needs procfs.
+func WriteIDMaps(pid int, uid, gid IDMap) error {
+	for _, m := range []struct {
+		name string
+		m    IDMap
+	}{{"uid_map", uid}, {"gid_map", gid}} {
+		if m.m == nil {
+			continue
+		}
+		path := filepath.Join(PROCFSPath, strconv.Itoa(pid), m.name)
+		if err := m.m.Validate(); err != nil {
+			return NewError("write", path, USER, err)
+		}
+		// the kernel requires the whole map in a single write
+		if err := writeFile(path, m.m.String()); err != nil {
+			return NewError("write", path, USER, err)
+		}
+	}
+	return nil
+}
+
+// ReadSetgroups is true if setgroups(2) is allowed in the user namespace of pid. Needs procfs.
+func ReadSetgroups(pid int) (bool, error) {
+	b, err := ioutil.ReadFile(filepath.Join(PROCFSPath, strconv.Itoa(pid), "setgroups"))
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(b)) == "allow", nil
+}
+
+// WriteSetgroups allows or denies setgroups(2) in the user namespace of pid. It can only be changed before
+// the gid map is written and deny is permanent. Needs procfs.
+func WriteSetgroups(pid int, allow bool) error {
+	v := "deny"
+	if allow {
+		v = "allow"
+	}
+	path := filepath.Join(PROCFSPath, strconv.Itoa(pid), "setgroups")
+	if err := writeFile(path, v); err != nil {
+		return NewError("write", path, USER, err)
+	}
+	return nil
+}
+
+// IDMaps returns the uid and gid maps of the user namespace, read through a member process. See ReadIDMaps
+func (ns *Namespace) IDMaps() (uid IDMap, gid IDMap, err error) {
+	if ns.typ != USER {
+		return nil, nil, ns.error("id maps", ErrNonUserNS)
+	}
+	err = ns.member(func(pid int) error {
+		uid, gid, err = ReadIDMaps(pid)
+		return err
+	})
+	return uid, gid, err
+}
+
+// TranslateUID returns the uid as seen by the caller for uid in the user namespace ns. That is the uid in the
+// parent of ns if the caller is in ns or its parent, otherwise in the caller's user namespace. See ReadIDMaps
+func TranslateUID(ns *Namespace, uid uint32) (uint32, error) {
+	m, _, err := ns.IDMaps()
+	if err != nil {
+		return 0, err
+	}
+	return translate(ns, m, uid)
+}
+
+// TranslateGID returns the gid as seen by the caller for gid in the user namespace ns. See TranslateUID
+func TranslateGID(ns *Namespace, gid uint32) (uint32, error) {
+	_, m, err := ns.IDMaps()
+	if err != nil {
+		return 0, err
+	}
+	return translate(ns, m, gid)
+}
+
+func translate(ns *Namespace, m IDMap, id uint32) (uint32, error) {
+	out, ok := m.ToParent(id)
+	if !ok {
+		return 0, ns.error("translate "+strconv.FormatUint(uint64(id), 10), ErrUnmappedID)
+	}
+	return out, nil
+}
+
+// member calls fn with the pid of a process in the namespace, trying the caller first. The process is checked to
+// still be in the namespace after fn returns, otherwise what fn read may come from a new process that reused
+// the pid and the next member is tried.
+func (ns *Namespace) member(fn func(pid int) error) error {
+	id := ns.ID()
+	if ns.hasMember(os.Getpid(), id) {
+		if err := fn(os.Getpid()); err != nil || ns.hasMember(os.Getpid(), id) {
+			return err
+		}
+	}
+	d, err := os.Open(PROCFSPath)
+	if err != nil {
+		return err
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		pid, err := strconv.Atoi(name)
+		if err != nil || pid == os.Getpid() || !ns.hasMember(pid, id) {
+			continue
+		}
+		err = fn(pid)
+		if ns.hasMember(pid, id) {
+			return err
+		}
+	}
+	return ns.error("member", ErrNoMember)
+}
+
+// hasMember is true if process pid is in the namespace with id
+func (ns *Namespace) hasMember(pid int, id ID) bool {
+	got, err := statID(filepath.Join(PROCFSPath, strconv.Itoa(pid), "ns", ns.typ.StringLower()), ns.typ)
+	return err == nil && got.Equal(id)
+}
@@ -0,0 +1,154 @@
+package namespace
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIDMap(t *testing.T) {
+	m, err := ParseIDMap("         0       1000          1\n         1     100000      65536\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := IDMap{{0, 1000, 1}, {1, 100000, 65536}}
+	if len(m) != len(want) || m[0] != want[0] || m[1] != want[1] {
+		t.Fatalf("expecting %v but got %v", want, m)
+	}
+	if s := m.String(); s != "0 1000 1\n1 100000 65536\n" {
+		t.Fatalf("unexpected format %q", s)
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := m.ToParent(10); !ok || id != 100009 {
+		t.Fatal("expecting 100009 but got", id, ok)
+	}
+	if id, ok := m.FromParent(1000); !ok || id != 0 {
+		t.Fatal("expecting 0 but got", id, ok)
+	}
+	if _, ok := m.ToParent(65537); ok {
+		t.Fatal("expecting 65537 to be unmapped")
+	}
+	if s := m.SysProcIDMap(); len(s) != 2 || s[1].HostID != 100000 || s[1].Size != 65536 {
+		t.Fatalf("unexpected SysProcIDMap %v", s)
+	}
+
+	for _, bad := range []IDMap{
+		{},
+		{{0, 1000, 0}},
+		{{0, 1000, 10}, {5, 2000, 10}},
+		{{0, 1000, 10}, {20, 1005, 10}},
+		{{0, 4294967290, 10}},
+	} {
+		if err := bad.Validate(); !errors.Is(err, ErrInvalidIDMap) {
+			t.Errorf("expecting ErrInvalidIDMap for %v but got %v", bad, err)
+		}
+	}
+	if _, err := ParseIDMap("0 1000\n"); err == nil {
+		t.Fatal("expecting error for malformed line")
+	}
+}
+
+func TestWriteIDMaps(t *testing.T) {
+	c, err := newProcess(NewMask().Set(USER))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+	pid := c.Process.Pid
+
+	allow, err := ReadSetgroups(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !allow {
+		t.Fatal("expecting setgroups allowed in a new user ns")
+	}
+	if err := WriteSetgroups(pid, false); err != nil {
+		t.Fatal(err)
+	}
+	if allow, err := ReadSetgroups(pid); err != nil || allow {
+		t.Fatal("expecting setgroups denied but got", allow, err)
+	}
+
+	if err := WriteIDMaps(pid, IDMap{{0, 0, 0}}, nil); !errors.Is(err, ErrInvalidIDMap) {
+		t.Fatal("expecting ErrInvalidIDMap but got", err)
+	}
+	uid := IDMap{{0, uint32(os.Getuid()), 1}, {1, 100000, 1000}}
+	gid := IDMap{{0, uint32(os.Getgid()), 1}}
+	if err := WriteIDMaps(pid, uid, gid); err != nil {
+		t.Fatal(err)
+	}
+	ruid, rgid, err := ReadIDMaps(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ruid.String() != uid.String() || rgid.String() != gid.String() {
+		t.Fatalf("expecting %v %v but got %v %v", uid, gid, ruid, rgid)
+	}
+
+	ns, err := FromPID(pid, USER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+	nuid, _, err := ns.IDMaps()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nuid.String() != uid.String() {
+		t.Fatalf("expecting %v but got %v", uid, nuid)
+	}
+	if id, err := TranslateUID(ns, 5); err != nil || id != 100004 {
+		t.Fatal("expecting 100004 but got", id, err)
+	}
+	if id, err := TranslateGID(ns, 0); err != nil || id != uint32(os.Getgid()) {
+		t.Fatal("expecting our gid but got", id, err)
+	}
+	if _, err := TranslateGID(ns, 1); !errors.Is(err, ErrUnmappedID) {
+		t.Fatal("expecting ErrUnmappedID but got", err)
+	}
+}
+
+func TestIDMapsNoMember(t *testing.T) {
+	c, err := newProcess(NewMask().Set(USER))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns, err := FromPID(c.Process.Pid, USER)
+	c.Process.Kill()
+	c.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+	if _, _, err := ns.IDMaps(); !errors.Is(err, ErrNoMember) {
+		t.Fatal("expecting ErrNoMember but got", err)
+	}
+}
+
+func TestReadIDMapsUnmapped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "idmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// a range the reader's user ns has no ids for
+	if err := ioutil.WriteFile(filepath.Join(dir, "1", "uid_map"), []byte("0 1000 1\n1 4294967295 65536\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p string) { PROCFSPath = p }(PROCFSPath)
+	PROCFSPath = dir
+	if _, _, err := ReadIDMaps(1); !errors.Is(err, ErrUnmappedID) {
+		t.Fatal("expecting ErrUnmappedID but got", err)
+	}
+}
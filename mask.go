@@ -13,11 +13,18 @@ func (m Mask) Has(t Type) bool {
 	return m&Mask(t) != 0
 }
 
-// Uintptr returns Mask as uintptr value
+// Uintptr returns Mask as uintptr value. TIME overlaps the exit signal bits of clone(2) and must not be
+// passed in syscall.SysProcAttr.Cloneflags, use CloneFlags for that.
 func (m Mask) Uintptr() uintptr {
 	return uintptr(m)
 }
 
+// CloneFlags returns the mask as clone(2) flags e.g. for syscall.SysProcAttr.Cloneflags. TIME is left out
+// as CLONE_NEWTIME overlaps the exit signal bits, a new time namespace can only be created with unshare.
+func (m Mask) CloneFlags() uintptr {
+	return m.Remove(TIME).Uintptr()
+}
+
 // Set adds namespace t to the mask and returns it
 func (m Mask) Set(t Type) Mask {
 	return m | Mask(t)
@@ -28,7 +35,22 @@ func (m Mask) Remove(t Type) Mask {
 	return m & ^Mask(t)
 }
 
-// SetAll returns a mask with all namespaces set
+// SetAll returns a mask with all namespaces set, including TIME. See CloneFlags
 func (m Mask) SetAll() Mask {
-	return Mask(MNT | NET | PID | IPC | UTS | USER | CGROUP)
+	return Mask(MNT | NET | PID | IPC | UTS | USER | CGROUP | TIME)
+}
+
+// setnsOrder is the order namespaces are entered, same as nsenter(1). user comes first so the
+// capabilities it grants are in effect for the rest.
+var setnsOrder = []Type{USER, CGROUP, IPC, UTS, NET, PID, MNT, TIME}
+
+// Types returns the namespace types set in the mask in the order they should be entered
+func (m Mask) Types() []Type {
+	out := []Type{}
+	for _, t := range setnsOrder {
+		if m.Has(t) {
+			out = append(out, t)
+		}
+	}
+	return out
 }
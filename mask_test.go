@@ -6,22 +6,23 @@ func TestMask(t *testing.T) {
 	{
 		m := NewMask().SetAll()
 
-		if m != Mask(MNT|NET|PID|IPC|UTS|USER|CGROUP) {
-			t.Fatal("mask is not Mask(MNT | NET | PID | IPC | UTS | USER | CGROUP)")
+		if m != Mask(MNT|NET|PID|IPC|UTS|USER|CGROUP|TIME) {
+			t.Fatal("mask is not Mask(MNT | NET | PID | IPC | UTS | USER | CGROUP | TIME)")
 		}
 	}
 	{
 		m := NewMask().SetAll().
 			Remove(MNT)
 
-		if m != Mask(NET|PID|IPC|UTS|USER|CGROUP) {
-			t.Fatal("mask is not Mask(NET | PID | IPC | UTS | USER | CGROUP)")
+		if m != Mask(NET|PID|IPC|UTS|USER|CGROUP|TIME) {
+			t.Fatal("mask is not Mask(NET | PID | IPC | UTS | USER | CGROUP | TIME)")
 		}
 	}
 	{
 		m := NewMask().SetAll().
 			Remove(MNT).
-			Remove(CGROUP)
+			Remove(CGROUP).
+			Remove(TIME)
 
 		if m != Mask(NET|PID|IPC|UTS|USER) {
 			t.Fatal("mask is not Mask(NET | PID | IPC | UTS | USER)")
@@ -52,3 +53,26 @@ func TestMask(t *testing.T) {
 		}
 	}
 }
+
+func TestMaskTypes(t *testing.T) {
+	tps := NewMask().SetAll().Types()
+	if len(tps) != len(Types()) {
+		t.Fatalf("expecting %d types but got %d", len(Types()), len(tps))
+	}
+	if tps[0] != USER {
+		t.Fatal("user ns should be entered first instead of", tps[0])
+	}
+}
+
+func TestMaskCloneFlags(t *testing.T) {
+	m := NewMask().SetAll()
+	if m.CloneFlags() != m.Remove(TIME).Uintptr() {
+		t.Fatal("expecting clone flags without TIME")
+	}
+	if m.CloneFlags()&0xff != 0 {
+		t.Fatal("clone flags overlap the exit signal")
+	}
+	if !m.Has(TIME) {
+		t.Fatal("CloneFlags should not change the mask")
+	}
+}
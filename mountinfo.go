@@ -0,0 +1,218 @@
+package namespace
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// MountInfo is a line of /proc/<pid>/mountinfo, see proc(5)
+type MountInfo struct {
+	// ID of the mount
+	ID int
+	// ParentID is the id of the parent mount, or of the mount itself for the root of the mount tree
+	ParentID int
+	// Dev is the device of the filesystem
+	Dev Dev
+	// Root is the path of the directory of the filesystem that is the root of the mount
+	Root string
+	// MountPoint is the path of the mount relative to the root of the process
+	MountPoint string
+	// Options are the per mount options e.g. rw,nosuid
+	Options string
+	// Optional are the raw optional fields e.g. shared:1 master:2
+	Optional []string
+	// Shared is the peer group of a shared mount, 0 if not shared
+	Shared int
+	// Master is the peer group a slave mount receives events from, 0 if not a slave
+	Master int
+	// PropagateFrom is the closest dominant peer group of a slave mount visible to the process, 0 if none
+	PropagateFrom int
+	// Unbindable is true for an unbindable mount
+	Unbindable bool
+	// FSType is the type of the filesystem e.g. ext4
+	FSType string
+	// Source is the filesystem specific source e.g. /dev/sda1
+	Source string
+	// SuperOptions are the options of the superblock
+	SuperOptions string
+}
+
+// Propagation returns the propagation type of the mount: shared, slave, shared,slave, unbindable or private
+func (m *MountInfo) Propagation() string {
+	switch {
+	case m.Shared != 0 && m.Master != 0:
+		return "shared,slave"
+	case m.Shared != 0:
+		return "shared"
+	case m.Master != 0:
+		return "slave"
+	case m.Unbindable:
+		return "unbindable"
+	}
+	return "private"
+}
+
+// ParseMountInfo returns the mounts in the format of /proc/<pid>/mountinfo
+func ParseMountInfo(r io.Reader) ([]*MountInfo, error) {
+	out := []*MountInfo{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if sc.Text() == "" {
+			continue
+		}
+		m, err := parseMountInfoLine(sc.Text())
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, sc.Err()
+}
+
+func parseMountInfoLine(line string) (*MountInfo, error) {
+	malformed := fmt.Errorf("malformed mountinfo line %q", line)
+	f := strings.Split(line, " ")
+	// the optional fields end with a single hyphen
+	sep := -1
+	for i := 6; i < len(f); i++ {
+		if f[i] == "-" {
+			sep = i
+			break
+		}
+	}
+	if sep < 0 || len(f) < sep+4 {
+		return nil, malformed
+	}
+	m := &MountInfo{
+		Root:         unescapeMountInfo(f[3]),
+		MountPoint:   unescapeMountInfo(f[4]),
+		Options:      f[5],
+		Optional:     append([]string{}, f[6:sep]...),
+		FSType:       unescapeMountInfo(f[sep+1]),
+		Source:       unescapeMountInfo(f[sep+2]),
+		SuperOptions: f[sep+3],
+	}
+	var err error
+	if m.ID, err = strconv.Atoi(f[0]); err != nil {
+		return nil, malformed
+	}
+	if m.ParentID, err = strconv.Atoi(f[1]); err != nil {
+		return nil, malformed
+	}
+	dev := strings.SplitN(f[2], ":", 2)
+	if len(dev) != 2 {
+		return nil, malformed
+	}
+	maj, err := strconv.ParseUint(dev[0], 10, 32)
+	if err != nil {
+		return nil, malformed
+	}
+	min, err := strconv.ParseUint(dev[1], 10, 32)
+	if err != nil {
+		return nil, malformed
+	}
+	m.Dev = Dev{
+		Major: uint32(maj),
+		Minor: uint32(min),
+	}
+	for _, o := range m.Optional {
+		kv := strings.SplitN(o, ":", 2)
+		var dst *int
+		switch kv[0] {
+		case "shared":
+			dst = &m.Shared
+		case "master":
+			dst = &m.Master
+		case "propagate_from":
+			dst = &m.PropagateFrom
+		case "unbindable":
+			m.Unbindable = true
+			continue
+		default:
+			// fields added by newer kernels
+			continue
+		}
+		if len(kv) != 2 {
+			return nil, malformed
+		}
+		if *dst, err = strconv.Atoi(kv[1]); err != nil {
+			return nil, malformed
+		}
+	}
+	return m, nil
+}
+
+// unescapeMountInfo replaces the octal escapes the kernel uses for space, tab, newline and backslash
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			b = append(b, (s[i+1]-'0')<<6|(s[i+2]-'0')<<3|(s[i+3]-'0'))
+			i += 3
+			continue
+		}
+		b = append(b, s[i])
+	}
+	return string(b)
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
+
+// ReadMountInfo returns the mounts as seen by process pid. Needs procfs.
+func ReadMountInfo(pid int) ([]*MountInfo, error) {
+	f, err := os.Open(filepath.Join(PROCFSPath, strconv.Itoa(pid), "mountinfo"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseMountInfo(f)
+}
+
+// Mounts returns the mount table of the mount namespace ns. It is read through a member process, or by
+// entering ns with Do if it has none. Paths are relative to the root of the process it is read from.
+func Mounts(ns *Namespace) ([]*MountInfo, error) {
+	if ns.typ != MNT {
+		return nil, ns.error("mounts", ErrNonMntNS)
+	}
+	var out []*MountInfo
+	err := ns.member(func(pid int) error {
+		var err error
+		out, err = ReadMountInfo(pid)
+		return err
+	})
+	if !errors.Is(err, ErrNoMember) {
+		return out, err
+	}
+	// the procfs is opened before entering ns, which might have none or one of another pid namespace. the thread
+	// that enters is only known inside
+	task, err := os.Open(filepath.Join(PROCFSPath, "self", "task"))
+	if err != nil {
+		return nil, err
+	}
+	defer task.Close()
+	err = ns.doAs(MNT, "mounts", ErrNonMntNS, func() error {
+		name := filepath.Join(strconv.Itoa(unix.Gettid()), "mountinfo")
+		fd, err := unix.Openat(int(task.Fd()), name, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return &os.PathError{Op: "openat", Path: filepath.Join(task.Name(), name), Err: err}
+		}
+		f := os.NewFile(uintptr(fd), filepath.Join(task.Name(), name))
+		defer f.Close()
+		out, err = ParseMountInfo(f)
+		return err
+	})
+	return out, err
+}
@@ -0,0 +1,157 @@
+package namespace
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	in := `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw,errors=remount-ro
+36 22 0:32 / /mnt/with\040space rw,nosuid master:2 propagate_from:3 - tmpfs tmp\011fs rw
+37 22 0:33 / /priv rw - tmpfs tmpfs rw
+38 22 0:34 /sub /unb rw unbindable - tmpfs tmpfs rw
+39 22 0:35 / /both rw shared:4 master:5 - tmpfs tmpfs rw
+`
+	mounts, err := ParseMountInfo(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) != 5 {
+		t.Fatal("expecting 5 mounts but got", len(mounts))
+	}
+	m := mounts[0]
+	if m.ID != 22 || m.ParentID != 1 || m.Dev != (Dev{8, 1}) || m.Root != "/" || m.MountPoint != "/" ||
+		m.Options != "rw,relatime" || m.FSType != "ext4" || m.Source != "/dev/sda1" ||
+		m.SuperOptions != "rw,errors=remount-ro" || m.Shared != 1 {
+		t.Fatalf("unexpected mount %+v", m)
+	}
+	m = mounts[1]
+	if m.MountPoint != "/mnt/with space" || m.Source != "tmp\tfs" || m.Master != 2 || m.PropagateFrom != 3 {
+		t.Fatalf("unexpected mount %+v", m)
+	}
+	if len(m.Optional) != 2 || m.Optional[0] != "master:2" {
+		t.Fatalf("unexpected optional fields %v", m.Optional)
+	}
+	for i, p := range []string{"shared", "slave", "private", "unbindable", "shared,slave"} {
+		if got := mounts[i].Propagation(); got != p {
+			t.Errorf("expecting %s for %s but got %s", p, mounts[i].MountPoint, got)
+		}
+	}
+	if mounts[3].Root != "/sub" {
+		t.Fatal("expecting root /sub but got", mounts[3].Root)
+	}
+
+	for _, bad := range []string{
+		"22 1 8:1 / / rw shared:1 ext4 /dev/sda1 rw",
+		"x 1 8:1 / / rw - ext4 /dev/sda1 rw",
+		"22 1 81 / / rw - ext4 /dev/sda1 rw",
+		"22 1 8:1 / / rw shared:x - ext4 /dev/sda1 rw",
+	} {
+		if _, err := ParseMountInfo(strings.NewReader(bad)); err == nil {
+			t.Errorf("expecting error for %q", bad)
+		}
+	}
+}
+
+func TestMounts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mounts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	nss, err := Unshare(NewMask().Set(MNT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := nss[MNT]
+	defer ns.Close()
+	err = ns.Do(func() error {
+		// keep the mount from propagating to our namespace
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+			return err
+		}
+		if err := unix.Mount("tmpfs", dir, "tmpfs", 0, ""); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// no member process, read by entering
+	mounts, err := Mounts(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, m := range mounts {
+		if m.MountPoint == dir {
+			found = true
+			if m.FSType != "tmpfs" || m.Propagation() != "private" {
+				t.Fatalf("unexpected mount %+v", m)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("expecting tmpfs on", dir)
+	}
+
+	// read through the caller
+	self, err := Self(MNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer self.Close()
+	mounts, err = Mounts(self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range mounts {
+		if m.MountPoint == dir {
+			t.Fatal("expecting no tmpfs on", dir, "in our mnt ns")
+		}
+	}
+
+	uts, err := Self(UTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uts.Close()
+	if _, err := Mounts(uts); !errors.Is(err, ErrNonMntNS) {
+		t.Fatal("expecting ErrNonMntNS but got", err)
+	}
+}
+
+func TestMountsMember(t *testing.T) {
+	c, err := newProcess(NewMask().Set(MNT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+	ns, err := FromPID(c.Process.Pid, MNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+	mounts, err := Mounts(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ReadMountInfo(c.Process.Pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) == 0 || len(mounts) != len(want) {
+		t.Fatalf("expecting %d mounts but got %d", len(want), len(mounts))
+	}
+}
@@ -0,0 +1,434 @@
+// Package mountns sets up a mount namespace from a list of mount operations, run inside the namespace and
+// rolled back if one of them fails.
+package mountns
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/thegrumpylion/namespace"
+	"golang.org/x/sys/unix"
+)
+
+// ErrNoUndo returned when rolling back an operation that can't be undone
+var ErrNoUndo = errors.New("operation can't be undone")
+
+// Op is a mount operation
+type Op interface {
+	// Apply performs the operation in the mount namespace of the calling thread and returns a function that
+	// undoes it
+	Apply() (undo func() error, err error)
+	// String describes the operation
+	String() string
+}
+
+// Error is returned by Apply when an operation fails
+type Error struct {
+	// Index of the operation that failed
+	Index int
+	// Op that failed
+	Op Op
+	// Err is the error of the operation
+	Err error
+	// Rollback are the errors of undoing the operations before Op, if any. Rolling back stops at an operation
+	// that can't be undone, with ErrNoUndo as the last error
+	Rollback []error
+}
+
+func (e *Error) Error() string {
+	s := e.Op.String() + ": " + e.Err.Error()
+	if len(e.Rollback) > 0 {
+		r := []string{}
+		for _, err := range e.Rollback {
+			r = append(r, err.Error())
+		}
+		s += " (rollback: " + strings.Join(r, "; ") + ")"
+	}
+	return s
+}
+
+// Unwrap returns the error of the operation
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Apply runs ops in order inside the mount namespace ns, see namespace.Do. If one fails the ones before it
+// are undone in reverse order and an *Error is returned. The operations before one that can't be undone, like
+// a PivotRoot with Detach, are left in place since their paths no longer resolve to what they applied to.
+func Apply(ns *namespace.Namespace, ops ...Op) error {
+	if ns.Type() != namespace.MNT {
+		return namespace.NewError("mountns", ns.FileName(), ns.Type(), namespace.ErrNonMntNS)
+	}
+	err := ns.Do(func() error {
+		return apply(ops)
+	})
+	var derr *namespace.DoError
+	if errors.As(err, &derr) && derr.Step == namespace.StepRun {
+		return derr.Err
+	}
+	return err
+}
+
+func apply(ops []Op) error {
+	undos := []func() error{}
+	for i, op := range ops {
+		undo, err := op.Apply()
+		if err == nil {
+			undos = append(undos, undo)
+			continue
+		}
+		e := &Error{
+			Index: i,
+			Op:    op,
+			Err:   err,
+		}
+		for j := len(undos) - 1; j >= 0; j-- {
+			if err := undos[j](); err != nil {
+				e.Rollback = append(e.Rollback, fmt.Errorf("%s: %w", ops[j], err))
+				if errors.Is(err, ErrNoUndo) {
+					break
+				}
+			}
+		}
+		return e
+	}
+	return nil
+}
+
+func unmount(target string) func() error {
+	return func() error {
+		return os.NewSyscallError("umount "+target, unix.Unmount(target, unix.MNT_DETACH))
+	}
+}
+
+// Bind bind mounts Source on Target, which has to exist
+type Bind struct {
+	Source string
+	Target string
+	// Recursive binds the mounts below Source too
+	Recursive bool
+	// ReadOnly remounts the bind mount read only, and the ones below it if Recursive
+	ReadOnly bool
+}
+
+// Apply bind mounts and returns a function that unmounts it
+func (b Bind) Apply() (func() error, error) {
+	flags := uintptr(unix.MS_BIND)
+	if b.Recursive {
+		flags |= unix.MS_REC
+	}
+	if err := unix.Mount(b.Source, b.Target, "", flags, ""); err != nil {
+		return nil, err
+	}
+	if b.ReadOnly {
+		targets := []string{b.Target}
+		if b.Recursive {
+			mounts, err := mountsUnder(b.Target, true)
+			if err != nil {
+				unix.Unmount(b.Target, unix.MNT_DETACH)
+				return nil, err
+			}
+			targets = targets[:0]
+			for _, m := range mounts {
+				targets = append(targets, m.MountPoint)
+			}
+		}
+		// the unmount detaches the ones below too, their remounts don't need undoing
+		for _, target := range targets {
+			if _, err := (RemountReadOnly{Target: target}).Apply(); err != nil {
+				unix.Unmount(b.Target, unix.MNT_DETACH)
+				return nil, err
+			}
+		}
+	}
+	return unmount(b.Target), nil
+}
+
+func (b Bind) String() string {
+	return "bind " + b.Source + " on " + b.Target
+}
+
+// Tmpfs mounts a tmpfs on Target, which has to exist
+type Tmpfs struct {
+	Target string
+	// Size limit in bytes, the kernel default of half the memory if 0
+	Size int64
+	// Mode of the root directory, the kernel default if 0
+	Mode os.FileMode
+}
+
+// Apply mounts the tmpfs and returns a function that unmounts it
+func (t Tmpfs) Apply() (func() error, error) {
+	opts := []string{}
+	if t.Size > 0 {
+		opts = append(opts, fmt.Sprintf("size=%d", t.Size))
+	}
+	if t.Mode != 0 {
+		opts = append(opts, fmt.Sprintf("mode=%o", t.Mode.Perm()))
+	}
+	if err := unix.Mount("tmpfs", t.Target, "tmpfs", 0, strings.Join(opts, ",")); err != nil {
+		return nil, err
+	}
+	return unmount(t.Target), nil
+}
+
+func (t Tmpfs) String() string {
+	return "tmpfs on " + t.Target
+}
+
+// Proc mounts a procfs for the pid namespace of the caller on Target, which has to exist
+type Proc struct {
+	Target string
+}
+
+// Apply mounts procfs and returns a function that unmounts it
+func (p Proc) Apply() (func() error, error) {
+	if err := unix.Mount("proc", p.Target, "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return nil, err
+	}
+	return unmount(p.Target), nil
+}
+
+func (p Proc) String() string {
+	return "proc on " + p.Target
+}
+
+// RemountReadOnly makes the mount at Target read only. Other flags of the mount are kept
+type RemountReadOnly struct {
+	Target string
+}
+
+// Apply remounts read only and returns a function that remounts read write
+func (r RemountReadOnly) Apply() (func() error, error) {
+	st := unix.Statfs_t{}
+	if err := unix.Statfs(r.Target, &st); err != nil {
+		return nil, err
+	}
+	// a bind remount has to repeat the flags that are locked in an unprivileged namespace
+	flags := uintptr(unix.MS_REMOUNT | unix.MS_BIND)
+	for stFlag, ms := range map[int64]uintptr{
+		unix.ST_NOSUID:      unix.MS_NOSUID,
+		unix.ST_NODEV:       unix.MS_NODEV,
+		unix.ST_NOEXEC:      unix.MS_NOEXEC,
+		unix.ST_NOATIME:     unix.MS_NOATIME,
+		unix.ST_NODIRATIME:  unix.MS_NODIRATIME,
+		unix.ST_RELATIME:    unix.MS_RELATIME,
+		unix.ST_SYNCHRONOUS: unix.MS_SYNCHRONOUS,
+	} {
+		if st.Flags&stFlag != 0 {
+			flags |= ms
+		}
+	}
+	if err := unix.Mount("", r.Target, "", flags|unix.MS_RDONLY, ""); err != nil {
+		return nil, err
+	}
+	if st.Flags&unix.ST_RDONLY != 0 {
+		return func() error { return nil }, nil
+	}
+	return func() error {
+		return os.NewSyscallError("remount "+r.Target, unix.Mount("", r.Target, "", flags, ""))
+	}, nil
+}
+
+func (r RemountReadOnly) String() string {
+	return "remount read only " + r.Target
+}
+
+// PropagationType of a mount, see mount_namespaces(7)
+type PropagationType uintptr
+
+const (
+	// Private mounts neither send nor receive mount events
+	Private PropagationType = unix.MS_PRIVATE
+	// Shared mounts send and receive mount events within their peer group
+	Shared PropagationType = unix.MS_SHARED
+	// Slave mounts receive mount events from their master peer group
+	Slave PropagationType = unix.MS_SLAVE
+	// Unbindable mounts are private and can't be bind mounted
+	Unbindable PropagationType = unix.MS_UNBINDABLE
+)
+
+var propagationNameMap = map[PropagationType]string{
+	Private:    "private",
+	Shared:     "shared",
+	Slave:      "slave",
+	Unbindable: "unbindable",
+}
+
+// String returns the name of the propagation type as in mountinfo
+func (p PropagationType) String() string {
+	return propagationNameMap[p]
+}
+
+// Propagation changes the propagation type of the mount at Target, and of the ones below it if Recursive
+type Propagation struct {
+	Target    string
+	Type      PropagationType
+	Recursive bool
+}
+
+// Apply changes the propagation and returns a function that restores the previous types. A shared mount that
+// was changed is made shared in a new peer group rather than rejoining its old one, and a slave that was changed
+// can't get its master back and becomes private instead. A mount that was shared and slave comes back only
+// shared.
+func (p Propagation) Apply() (func() error, error) {
+	prev, err := propagations(p.Target, p.Recursive)
+	if err != nil {
+		return nil, err
+	}
+	flags := uintptr(p.Type)
+	if p.Recursive {
+		flags |= unix.MS_REC
+	}
+	if err := unix.Mount("", p.Target, "", flags, ""); err != nil {
+		return nil, err
+	}
+	return func() error {
+		// parents first, a mount below a private one can't be made shared otherwise
+		for _, m := range prev {
+			if err := unix.Mount("", m.MountPoint, "", m.flags, ""); err != nil {
+				return os.NewSyscallError("restore propagation "+m.MountPoint, err)
+			}
+		}
+		return nil
+	}, nil
+}
+
+func (p Propagation) String() string {
+	s := "make " + p.Type.String() + " " + p.Target
+	if p.Recursive {
+		s = "make r" + p.Type.String() + " " + p.Target
+	}
+	return s
+}
+
+type propagation struct {
+	namespace.MountInfo
+	flags uintptr
+}
+
+// propagations returns the propagation flags of the mount at target, and the ones below it if recursive, in
+// the order of the mount table
+func propagations(target string, recursive bool) ([]propagation, error) {
+	mounts, err := mountsUnder(target, recursive)
+	if err != nil {
+		return nil, err
+	}
+	out := []propagation{}
+	for _, m := range mounts {
+		var flags uintptr
+		switch {
+		case m.Shared != 0:
+			flags = unix.MS_SHARED
+		case m.Unbindable:
+			flags = unix.MS_UNBINDABLE
+		default:
+			flags = unix.MS_PRIVATE
+		}
+		out = append(out, propagation{
+			MountInfo: *m,
+			flags:     flags,
+		})
+	}
+	return out, nil
+}
+
+// mountsUnder returns the mounts at target, and the ones below it if recursive, in the order of the mount table
+// of the calling thread
+func mountsUnder(target string, recursive bool) ([]*namespace.MountInfo, error) {
+	target = filepath.Clean(target)
+	f, err := os.Open(filepath.Join(namespace.PROCFSPath, "thread-self", "mountinfo"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	mounts, err := namespace.ParseMountInfo(f)
+	if err != nil {
+		return nil, err
+	}
+	out := []*namespace.MountInfo{}
+	for _, m := range mounts {
+		under := m.MountPoint == target ||
+			recursive && strings.HasPrefix(m.MountPoint, strings.TrimSuffix(target, "/")+"/")
+		if under {
+			out = append(out, m)
+		}
+	}
+	if len(out) == 0 {
+		return nil, &os.PathError{Op: "mountinfo", Path: target, Err: unix.EINVAL}
+	}
+	return out, nil
+}
+
+// PivotRoot makes NewRoot the root mount of the namespace and changes the root and working directory of the
+// thread to it, see pivot_root(2). NewRoot has to be a mount point, e.g. bind mounted on itself, and not shared.
+type PivotRoot struct {
+	NewRoot string
+	// PutOld is where the old root is moved to, relative to NewRoot. Created if missing
+	PutOld string
+	// Detach unmounts the old root after the pivot. It can't be undone then, and the operations before it are
+	// not rolled back either
+	Detach bool
+}
+
+// Apply pivots and returns a function that pivots back
+func (p PivotRoot) Apply() (func() error, error) {
+	putOld := filepath.Join(p.NewRoot, p.PutOld)
+	created := false
+	if _, err := os.Stat(putOld); os.IsNotExist(err) {
+		if err := os.Mkdir(putOld, 0700); err != nil {
+			return nil, err
+		}
+		created = true
+	}
+	if err := unix.PivotRoot(p.NewRoot, putOld); err != nil {
+		if created {
+			os.Remove(putOld)
+		}
+		return nil, os.NewSyscallError("pivot_root", err)
+	}
+	// where the old root is now
+	old := filepath.Join("/", p.PutOld)
+	undo := func() error {
+		// the new root goes back to where it was mounted in the old one
+		if err := unix.PivotRoot(old, filepath.Join(old, p.NewRoot)); err != nil {
+			return os.NewSyscallError("pivot_root", err)
+		}
+		if err := unix.Chdir("/"); err != nil {
+			return err
+		}
+		if created {
+			os.Remove(putOld)
+		}
+		return nil
+	}
+	// failing after the pivot pivots back, so the operation is applied fully or not at all
+	undoErr := func(err error) error {
+		if uerr := undo(); uerr != nil {
+			return fmt.Errorf("%w (undo: %v)", err, uerr)
+		}
+		return err
+	}
+	if err := unix.Chdir("/"); err != nil {
+		return nil, undoErr(err)
+	}
+	if p.Detach {
+		if err := unix.Unmount(old, unix.MNT_DETACH); err != nil {
+			return nil, undoErr(os.NewSyscallError("umount "+old, err))
+		}
+		if created {
+			os.Remove(old)
+		}
+		return func() error {
+			return ErrNoUndo
+		}, nil
+	}
+	return undo, nil
+}
+
+func (p PivotRoot) String() string {
+	return "pivot root to " + p.NewRoot
+}
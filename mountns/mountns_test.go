@@ -0,0 +1,200 @@
+package mountns
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thegrumpylion/namespace"
+	"golang.org/x/sys/unix"
+)
+
+func newMntNS(t *testing.T) *namespace.Namespace {
+	nss, err := namespace.Unshare(namespace.NewMask().Set(namespace.MNT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nss[namespace.MNT]
+}
+
+func mountsAt(t *testing.T, ns *namespace.Namespace) map[string]*namespace.MountInfo {
+	mounts, err := namespace.Mounts(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := map[string]*namespace.MountInfo{}
+	for _, m := range mounts {
+		out[m.MountPoint] = m
+	}
+	return out
+}
+
+func TestApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mountns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "tmp")
+	ro := filepath.Join(dir, "ro")
+	proc := filepath.Join(dir, "proc")
+	src := filepath.Join(dir, "src")
+	rec := filepath.Join(dir, "rec")
+	for _, d := range []string{tmp, ro, proc, src, filepath.Join(src, "sub"), rec} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ns := newMntNS(t)
+	defer ns.Close()
+	err = Apply(ns,
+		Propagation{Target: "/", Type: Private, Recursive: true},
+		Tmpfs{Target: tmp, Size: 1 << 20, Mode: 0700},
+		Bind{Source: tmp, Target: ro, ReadOnly: true},
+		Proc{Target: proc},
+		Propagation{Target: tmp, Type: Shared},
+		Tmpfs{Target: filepath.Join(src, "sub")},
+		Bind{Source: src, Target: rec, Recursive: true, ReadOnly: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mounts := mountsAt(t, ns)
+	if m := mounts[tmp]; m == nil || m.FSType != "tmpfs" || m.Propagation() != "shared" || !strings.Contains(m.SuperOptions, "size=1024k") {
+		t.Fatalf("unexpected tmpfs mount %+v", m)
+	}
+	if m := mounts[ro]; m == nil || !strings.HasPrefix(m.Options, "ro") || m.Propagation() != "private" {
+		t.Fatalf("unexpected read only bind mount %+v", m)
+	}
+	for _, p := range []string{rec, filepath.Join(rec, "sub")} {
+		if m := mounts[p]; m == nil || !strings.HasPrefix(m.Options, "ro") {
+			t.Fatalf("unexpected recursive read only bind mount %+v", m)
+		}
+	}
+	if m := mounts[proc]; m == nil || m.FSType != "proc" {
+		t.Fatalf("unexpected proc mount %+v", m)
+	}
+	if m := mounts["/"]; m.Propagation() != "private" {
+		t.Fatalf("expecting private root but got %s", m.Propagation())
+	}
+
+	// nothing leaked into our namespace
+	self, err := namespace.Self(namespace.MNT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer self.Close()
+	if m := mountsAt(t, self)[tmp]; m != nil {
+		t.Fatal("unexpected mount in our ns", m)
+	}
+}
+
+func TestApplyRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mountns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ns := newMntNS(t)
+	defer ns.Close()
+	if err := Apply(ns, Propagation{Target: "/", Type: Private, Recursive: true}); err != nil {
+		t.Fatal(err)
+	}
+	err = Apply(ns,
+		Propagation{Target: "/", Type: Shared},
+		Tmpfs{Target: dir},
+		Bind{Source: filepath.Join(dir, "nope"), Target: dir},
+	)
+	var merr *Error
+	if !errors.As(err, &merr) {
+		t.Fatal("expecting *Error but got", err)
+	}
+	if merr.Index != 2 || !errors.Is(err, unix.ENOENT) || len(merr.Rollback) != 0 {
+		t.Fatalf("unexpected error %+v", merr)
+	}
+	mounts := mountsAt(t, ns)
+	if mounts[dir] != nil {
+		t.Fatal("expecting tmpfs to be rolled back but got", mounts[dir])
+	}
+	if mounts["/"].Propagation() != "private" {
+		t.Fatal("expecting root propagation rolled back to private but got", mounts["/"].Propagation())
+	}
+
+	uts, err := namespace.Self(namespace.UTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uts.Close()
+	if err := Apply(uts); !errors.Is(err, namespace.ErrNonMntNS) {
+		t.Fatal("expecting ErrNonMntNS but got", err)
+	}
+}
+
+func TestPivotRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mountns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "marker"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// rolled back after a later failure
+	ns := newMntNS(t)
+	defer ns.Close()
+	err = Apply(ns,
+		Propagation{Target: "/", Type: Private, Recursive: true},
+		Bind{Source: dir, Target: dir},
+		PivotRoot{NewRoot: dir, PutOld: "old"},
+		Tmpfs{Target: "/nope"},
+	)
+	var merr *Error
+	if !errors.As(err, &merr) || merr.Index != 3 || len(merr.Rollback) != 0 {
+		t.Fatal("expecting failure of the last op with a clean rollback but got", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old")); !os.IsNotExist(err) {
+		t.Fatal("expecting put old dir to be removed but got", err)
+	}
+	if m := mountsAt(t, ns)[dir]; m != nil {
+		t.Fatal("expecting bind mount rolled back but got", m)
+	}
+
+	// nothing before a detached pivot is rolled back, their paths are gone
+	detached := newMntNS(t)
+	defer detached.Close()
+	err = Apply(detached,
+		Propagation{Target: "/", Type: Private, Recursive: true},
+		Bind{Source: dir, Target: dir},
+		PivotRoot{NewRoot: dir, PutOld: "old", Detach: true},
+		Tmpfs{Target: "/nope"},
+	)
+	if !errors.As(err, &merr) || merr.Index != 3 || len(merr.Rollback) != 1 || !errors.Is(merr.Rollback[0], ErrNoUndo) {
+		t.Fatal("expecting rollback to stop at the detached pivot but got", err)
+	}
+
+	err = Apply(ns,
+		Bind{Source: dir, Target: dir},
+		PivotRoot{NewRoot: dir, PutOld: "old", Detach: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ns.Do(func() error {
+		_, err := os.Stat("/marker")
+		return err
+	})
+	if err != nil {
+		t.Fatal("expecting marker in new root but got", err)
+	}
+	mounts := mountsAt(t, ns)
+	if len(mounts) != 1 || mounts["/"] == nil {
+		t.Fatalf("expecting only the new root but got %d mounts", len(mounts))
+	}
+}
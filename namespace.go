@@ -4,14 +4,17 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 
 	"golang.org/x/sys/unix"
 )
 
-// PROCFSPath proc fs path
+// PROCFSPath proc fs path used by the package level functions. Changing it is not safe while they are in use, use
+// a Proc instead to look up namespaces in another procfs
 var PROCFSPath = "/proc"
 
 // ErrFileNotNamspace returned when trying to open a file that is not a reference to some namspace
@@ -30,6 +33,34 @@ var ErrNonHierarchicalNS = errors.New("ns not hierarchical (pid or user)")
 // ErrNonUserNS returned when calling OwnerUID on a non user namespace
 var ErrNonUserNS = errors.New("only valid for user ns")
 
+// ErrNonNetNS returned when creating a socket inside a namespace that is not a network namespace
+var ErrNonNetNS = errors.New("only valid for net ns")
+
+// ErrNonUTSNS returned when setting or reading names of a namespace that is not an uts namespace
+var ErrNonUTSNS = errors.New("only valid for uts ns")
+
+// ErrNameTooLong returned when a hostname or domainname is longer than the kernel allows
+var ErrNameTooLong = errors.New("name longer than 64 bytes")
+
+// ErrNonMntNS returned when reading the mounts of a namespace that is not a mount namespace
+var ErrNonMntNS = errors.New("only valid for mnt ns")
+
+// ErrClosed returned when acting on a namespace that has been closed
+var ErrClosed = errors.New("namespace closed")
+
+// ErrNotProcfs returned by OpenProc when the path is not a procfs mount
+var ErrNotProcfs = errors.New("not a procfs mount")
+
+// ErrNoForChildren returned when calling ForChildren for a type other than pid or time
+var ErrNoForChildren = errors.New("only pid and time ns have a for_children ns")
+
+// ErrSingleThreaded returned when joining a user or time namespace, which the kernel only allows for a single
+// threaded process
+var ErrSingleThreaded = errors.New("needs a single threaded process")
+
+// ErrUnsharePID returned when calling Unshare with PID. A new pid namespace can't be opened until its init process exists
+var ErrUnsharePID = errors.New("pid ns has no init process")
+
 // Type of the namespace
 type Type int
 
@@ -48,6 +79,8 @@ const (
 	USER = unix.CLONE_NEWUSER
 	// CGROUP namespace
 	CGROUP = unix.CLONE_NEWCGROUP
+	// TIME namespace. CLONE_NEWTIME is not yet exported by x/sys/unix
+	TIME = 0x80
 	// INVALID for use in TypeFromString
 	INVALID = 0
 )
@@ -60,6 +93,7 @@ var typeNameMap = map[Type]string{
 	UTS:    "UTS",
 	USER:   "USER",
 	CGROUP: "CGROUP",
+	TIME:   "TIME",
 }
 
 // String returns the uper case type of namespace
@@ -94,32 +128,105 @@ func Types() []Type {
 	return out
 }
 
-// Namespace represents an open file that points to some type of namspace
+// Namespace represents an open file that points to some type of namspace. It is safe for concurrent use.
 type Namespace struct {
 	typ    Type
 	file   *os.File
 	stat   *syscall.Stat_t
+	mu     sync.RWMutex
 	closed bool
 }
 
+func newNamespace(t Type, f *os.File, stat *syscall.Stat_t) *Namespace {
+	ns := &Namespace{
+		typ:  t,
+		file: f,
+		stat: stat,
+	}
+	leakMu.Lock()
+	fn := leakFunc
+	leakMu.Unlock()
+	if fn != nil {
+		runtime.SetFinalizer(ns, func(ns *Namespace) {
+			ns.mu.Lock()
+			defer ns.mu.Unlock()
+			if ns.closed {
+				return
+			}
+			ns.closed = true
+			ns.file.Close()
+			fn(ns.ID(), ns.FileName())
+		})
+	}
+	return ns
+}
+
+var (
+	leakMu   sync.Mutex
+	leakFunc LeakFunc
+)
+
+// LeakFunc is called with the id and file name of a namespace that was garbage collected without being closed
+type LeakFunc func(id ID, name string)
+
+// SetLeakFunc makes namespaces that are garbage collected without being closed close themselves and call fn.
+// Only namespaces created after the call are affected. A nil fn stops tracking new namespaces.
+func SetLeakFunc(fn LeakFunc) {
+	leakMu.Lock()
+	leakFunc = fn
+	leakMu.Unlock()
+}
+
+// use calls fn with the file descriptor of ns, which is kept open until fn returns. Errors are returned as
+// *NamespaceError for op.
+func (ns *Namespace) use(op string, fn func(fd uintptr) error) error {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+	if ns.closed {
+		return ns.error(op, ErrClosed)
+	}
+	if err := fn(ns.file.Fd()); err != nil {
+		if ne, ok := err.(*NamespaceError); ok {
+			ne.Path = ns.file.Name()
+			ne.Type = ns.typ
+			return ne
+		}
+		return ns.error(op, err)
+	}
+	return nil
+}
+
+func (ns *Namespace) error(op string, err error) *NamespaceError {
+	return NewError(op, ns.file.Name(), ns.typ, err)
+}
+
 // Type returns the namespace type
 func (ns *Namespace) Type() Type {
 	return ns.typ
 }
 
-// Fd returns the number of the file descriptor. Panics if namespace has been closed.
+// Fd returns the number of the file descriptor. Returns -1 if namespace has been closed. The descriptor is only
+// valid as long as nothing closes ns, use Control to keep it open while using it.
 func (ns *Namespace) Fd() int {
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
 	if ns.closed {
-		panic("acting on a closed namespace")
+		return -1
 	}
 	return int(ns.file.Fd())
 }
 
-// Ino returns the inode number of namspace. Panics if namespace has been closed.
+// Control calls fn with the file descriptor of ns, which is kept open until fn returns, like
+// syscall.RawConn.Control. fn must not keep the descriptor. Returns ErrClosed if namespace has been closed.
+func (ns *Namespace) Control(fn func(fd uintptr)) error {
+	return ns.use("control", func(fd uintptr) error {
+		fn(fd)
+		return nil
+	})
+}
+
+// Ino returns the inode number of namspace. Still valid after the namespace has been closed.
 func (ns *Namespace) Ino() uint64 {
-	if ns.closed {
-		panic("acting on a closed namespace")
-	}
 	return ns.stat.Ino
 }
 
@@ -134,135 +241,147 @@ func (d Dev) Dev() uint64 {
 	return unix.Mkdev(d.Major, d.Minor)
 }
 
-// Dev returns the inode number of namspace. Panics if namespace has been closed.
+// Dev returns the inode number of namspace. Still valid after the namespace has been closed.
 func (ns *Namespace) Dev() Dev {
-	if ns.closed {
-		panic("acting on a closed namespace")
-	}
 	return Dev{
 		Major: unix.Major(ns.stat.Dev),
 		Minor: unix.Minor(ns.stat.Dev),
 	}
 }
 
-// FileName returns the name of file. Panics if namespace has been closed.
+// FileName returns the name of file. Still valid after the namespace has been closed.
 func (ns *Namespace) FileName() string {
-	if ns.closed {
-		panic("acting on a closed namespace")
-	}
 	return ns.file.Name()
 }
 
-// Set the callers namespace to ns. Panics if namespace has been closed.
+// Set the callers namespace to ns. Returns ErrClosed if namespace has been closed.
 func (ns *Namespace) Set() error {
-	if ns.closed {
-		panic("acting on a closed namespace")
-	}
-	return unix.Setns(ns.Fd(), int(ns.typ))
+	return ns.use("setns", func(fd uintptr) error {
+		return unix.Setns(int(fd), int(ns.typ))
+	})
 }
 
-// Close the file descriptor holding the namespace. Panics if namespace has been closed.
+// Close the file descriptor holding the namespace. Closing a closed namespace does nothing.
 func (ns *Namespace) Close() error {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
 	if ns.closed {
-		panic("acting on a closed namespace")
+		return nil
 	}
 	ns.closed = true
-	return ns.file.Close()
+	runtime.SetFinalizer(ns, nil)
+	if err := ns.file.Close(); err != nil {
+		return ns.error("close", err)
+	}
+	return nil
 }
 
-// SetAndClose sets the callers namespace to ns then closes the file. Panics if namespace has been closed.
+// SetAndClose sets the callers namespace to ns then closes the file. Returns ErrClosed if namespace has been closed.
 func (ns *Namespace) SetAndClose() error {
-	err := unix.Setns(ns.Fd(), int(ns.typ))
-	if err != nil {
+	if err := ns.Set(); err != nil {
 		return err
 	}
 	return ns.Close()
 }
 
-// OwningUserNS returns the owning user namespace for a namespace. Panics if namespace has been closed.
+// OwningUserNS returns the user namespace that owns ns, for a user namespace that is its parent. Returns
+// ErrClosed if namespace has been closed.
 func (ns *Namespace) OwningUserNS() (*Namespace, error) {
-	if ns.closed {
-		panic("acting on a closed namespace")
-	}
-	if ns.typ != USER {
-		return nil, ErrNonUserNS
-	}
-	f, err := ioctlGetHierarchichal(ns.file.Fd(), unix.NS_GET_USERNS)
+	var f *os.File
+	err := ns.use("owning user ns", func(fd uintptr) error {
+		var err error
+		f, err = ioctlGetHierarchichal(fd, unix.NS_GET_USERNS)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	stat, err := stat(f)
 	if err != nil {
-		return nil, err
+		f.Close()
+		return nil, ns.error("owning user ns", err)
 	}
-	return &Namespace{
-		typ:  USER,
-		file: f,
-		stat: stat,
-	}, nil
+	return newNamespace(USER, f, stat), nil
 }
 
-// Parent returns the parent namespace for a user or pid namespace. Panics if namespace has been closed.
+// Parent returns the parent namespace for a user or pid namespace. Returns ErrClosed if namespace has been closed.
 func (ns *Namespace) Parent() (*Namespace, error) {
-	if ns.closed {
-		panic("acting on a closed namespace")
-	}
 	if !(ns.typ == PID || ns.typ == USER) {
-		return nil, ErrNonHierarchicalNS
+		return nil, ns.error("parent", ErrNonHierarchicalNS)
 	}
-	f, err := ioctlGetHierarchichal(ns.file.Fd(), unix.NS_GET_PARENT)
+	var f *os.File
+	err := ns.use("parent", func(fd uintptr) error {
+		var err error
+		f, err = ioctlGetHierarchichal(fd, unix.NS_GET_PARENT)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	stat, err := stat(f)
 	if err != nil {
-		return nil, err
+		f.Close()
+		return nil, ns.error("parent", err)
 	}
-	return &Namespace{
-		typ:  ns.typ,
-		file: f,
-		stat: stat,
-	}, nil
+	return newNamespace(ns.typ, f, stat), nil
 }
 
-// OwnerUID returns the owner UID for a user namespace. Panics if namespace has been closed.
+// OwnerUID returns the owner UID for a user namespace. Returns ErrClosed if namespace has been closed.
 func (ns *Namespace) OwnerUID() (int, error) {
-	if ns.closed {
-		panic("acting on a closed namespace")
-	}
 	if ns.typ != USER {
-		return 0, ErrNonUserNS
+		return 0, ns.error("owner uid", ErrNonUserNS)
 	}
-	return unix.IoctlGetInt(int(ns.file.Fd()), unix.NS_GET_OWNER_UID)
+	uid := 0
+	err := ns.use("owner uid", func(fd uintptr) error {
+		var err error
+		uid, err = unix.IoctlGetInt(int(fd), unix.NS_GET_OWNER_UID)
+		return err
+	})
+	return uid, err
 }
 
-// Dup will return a duplicate of ns. Panics if namespace has been closed.
+// Dup will return a duplicate of ns. Returns ErrClosed if namespace has been closed.
 func (ns *Namespace) Dup() (*Namespace, error) {
-	if ns.closed {
-		panic("acting on a closed namespace")
+	f, err := ns.File()
+	if err != nil {
+		return nil, err
 	}
-	fd, err := unix.Dup(int(ns.file.Fd()))
+	dup, err := FromFile(f)
 	if err != nil {
+		f.Close()
 		return nil, err
 	}
-	return FromFD(fd, ns.file.Name())
+	return dup, nil
 }
 
-// FromFile return a new namspace from open file. It fails if the file doesn't point to a namespace
-func FromFile(f *os.File) (*Namespace, error) {
-	t, err := ioctlGetType(f.Fd())
+// File returns a duplicate of the namespace file e.g. for exec.Cmd.ExtraFiles. Closing it doesn't affect ns.
+// Returns ErrClosed if namespace has been closed.
+func (ns *Namespace) File() (*os.File, error) {
+	newFd := 0
+	err := ns.use("dup", func(fd uintptr) error {
+		var err error
+		newFd, err = unix.Dup(int(fd))
+		return err
+	})
 	if err != nil {
-		return nil, ErrFileNotNamspace
+		return nil, err
+	}
+	return os.NewFile(uintptr(newFd), ns.file.Name()), nil
+}
+
+// FromFile return a new namspace from open file. It fails with ErrFileNotNamspace if the file doesn't point to
+// a namespace
+func FromFile(f *os.File) (*Namespace, error) {
+	t, nerr := ioctlGetType(f.Fd())
+	if nerr != nil {
+		nerr.Path = f.Name()
+		return nil, nerr
 	}
 	stat, err := stat(f)
 	if err != nil {
-		return nil, err
+		return nil, NewError("stat", f.Name(), t, err)
 	}
-	return &Namespace{
-		typ:  Type(t),
-		file: f,
-		stat: stat,
-	}, nil
+	return newNamespace(t, f, stat), nil
 }
 
 // FromFD return a new namspace from a file desriptor number. It fails if the file doesn't point to a namespace
@@ -273,21 +392,62 @@ func FromFD(fd int, name string) (*Namespace, error) {
 
 // FromPath return a new namspace from the given path. It fails if the file doesn't point to a namespace
 func FromPath(path string) (*Namespace, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	return FromFile(f)
+	return fromPath(path, INVALID)
 }
 
 // FromPID return a new namspace for a PID and Type. Needs procfs.
 func FromPID(pid int, t Type) (*Namespace, error) {
-	return FromPath(filepath.Join(PROCFSPath, strconv.Itoa(pid), "ns", t.StringLower()))
+	return fromPath(filepath.Join(PROCFSPath, strconv.Itoa(pid), "ns", t.StringLower()), t)
 }
 
 // Self return a new namspace of type t of the caller. Needs procfs.
 func Self(t Type) (*Namespace, error) {
-	return FromPath(filepath.Join(PROCFSPath, "self", "ns", t.StringLower()))
+	return fromPath(filepath.Join(PROCFSPath, "self", "ns", t.StringLower()), t)
+}
+
+// ThreadSelf return a new namspace of type t of the calling thread. Self returns the one of the thread group
+// leader, this one reflects Set on the calling thread which should be locked with runtime.LockOSThread. Needs procfs.
+func ThreadSelf(t Type) (*Namespace, error) {
+	return fromPath(filepath.Join(PROCFSPath, "thread-self", "ns", t.StringLower()), t)
+}
+
+// FromTID return a new namspace of Type for thread tid of process pid. Needs procfs.
+func FromTID(pid, tid int, t Type) (*Namespace, error) {
+	return fromPath(filepath.Join(PROCFSPath, strconv.Itoa(pid), "task", strconv.Itoa(tid), "ns", t.StringLower()), t)
+}
+
+// ForChildren return a new namspace of type t, PID or TIME, that children of process pid are created in. For PID it
+// fails until the first process of a new namespace exists. Needs procfs.
+func ForChildren(pid int, t Type) (*Namespace, error) {
+	name, err := forChildrenName(t)
+	if err != nil {
+		return nil, err
+	}
+	return fromPath(filepath.Join(PROCFSPath, strconv.Itoa(pid), "ns", name), t)
+}
+
+func forChildrenName(t Type) (string, error) {
+	if !(t == PID || t == TIME) {
+		return "", NewError("for children", "", t, ErrNoForChildren)
+	}
+	return t.StringLower() + "_for_children", nil
+}
+
+// fromPath opens path as FromPath does, t is only used for errors
+func fromPath(path string, t Type) (*Namespace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, NewError("open", path, t, err)
+	}
+	ns, err := FromFile(f)
+	if err != nil {
+		f.Close()
+		if ne, ok := err.(*NamespaceError); ok && ne.Type == INVALID {
+			ne.Type = t
+		}
+		return nil, err
+	}
+	return ns, nil
 }
 
 func stat(f *os.File) (*syscall.Stat_t, error) {
@@ -302,27 +462,39 @@ func stat(f *os.File) (*syscall.Stat_t, error) {
 	return stat, nil
 }
 
-func ioctlGetType(fd uintptr) (Type, error) {
+func ioctlGetType(fd uintptr) (Type, *NamespaceError) {
 	a, _, e := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.NS_GET_NSTYPE, uintptr(0))
 	if e != 0 {
+		err := &NamespaceError{
+			Op:  "nstype",
+			Err: e,
+		}
 		if e == unix.ENOTTY {
-			return Type(0), ErrFileNotNamspace
+			err.sentinel = ErrFileNotNamspace
 		}
-		return Type(0), e
+		return Type(0), err
 	}
 	return Type(a), nil
 }
 
+// ioctlGetHierarchichal returns a *NamespaceError without Path and Type on failure
 func ioctlGetHierarchichal(fd, call uintptr) (*os.File, error) {
 	fdOut, _, e := unix.Syscall(unix.SYS_IOCTL, fd, call, uintptr(0))
 	if e != 0 {
+		err := &NamespaceError{
+			Op:  "parent",
+			Err: e,
+		}
+		if call == unix.NS_GET_USERNS {
+			err.Op = "owning user ns"
+		}
 		if e == unix.ENOTTY {
-			return nil, ErrKernelNoSupport
+			err.sentinel = ErrKernelNoSupport
 		}
 		if e == unix.EPERM {
-			return nil, ErrNotPermitted
+			err.sentinel = ErrNotPermitted
 		}
-		return nil, e
+		return nil, err
 	}
 	return os.NewFile(fdOut, ""), nil
 }
@@ -1,15 +1,21 @@
 package namespace
 
 import (
+	"errors"
+	"os"
 	"os/exec"
+	"runtime"
 	"syscall"
 	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 func newProcess(m Mask) (*exec.Cmd, error) {
 	c := exec.Command("sleep", "7200")
 	c.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: m.Uintptr(),
+		Cloneflags: m.CloneFlags(),
 	}
 	if err := c.Start(); err != nil {
 		return nil, err
@@ -72,7 +78,7 @@ func TestHierarchical(t *testing.T) {
 			if err == nil {
 				t.Fatal("ns.Parent should have failed for", ns.Type().String())
 			}
-			if err != ErrNonHierarchicalNS {
+			if !errors.Is(err, ErrNonHierarchicalNS) {
 				t.Fatal("error should have been ErrNonHierarchicalNS instead of", err)
 			}
 			continue
@@ -98,3 +104,177 @@ func TestHierarchical(t *testing.T) {
 		t.Fatal("fail to kill process", ppid)
 	}
 }
+
+func TestOwningUserNS(t *testing.T) {
+	m := NewMask().SetAll()
+
+	c, err := newProcess(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+
+	ppid := c.Process.Pid
+
+	usr, err := FromPID(ppid, USER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer usr.Close()
+
+	for _, nsType := range Types() {
+		ns, err := FromPID(ppid, nsType)
+		if err != nil {
+			t.Fatalf("fail to get %s ns for pid %d: %v", nsType, ppid, err)
+		}
+		defer ns.Close()
+
+		own, err := ns.OwningUserNS()
+		if err != nil {
+			t.Fatal(nsType.StringLower(), err)
+		}
+		defer own.Close()
+		if own.Type() != USER {
+			t.Fatal("owning ns should be USER instead of", own.Type())
+		}
+
+		// the user ns is owned by its parent, the rest by the new user ns the process was cloned with
+		if nsType == USER || nsType == TIME {
+			continue
+		}
+		if own.Ino() != usr.Ino() {
+			t.Fatalf("%s ns should be owned by the new user ns", nsType)
+		}
+	}
+}
+
+func TestClosed(t *testing.T) {
+	ns, err := Self(NET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ino := ns.Ino()
+
+	if err := ns.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.Close(); err != nil {
+		t.Fatal("second close should do nothing instead of", err)
+	}
+
+	if ns.Fd() != -1 {
+		t.Fatal("closed namespace fd should be -1 instead of", ns.Fd())
+	}
+	if ns.Ino() != ino {
+		t.Fatal("ino should stay valid after close")
+	}
+	if err := ns.Set(); !errors.Is(err, ErrClosed) {
+		t.Fatal("expecting ErrClosed from Set but got", err)
+	}
+	if _, err := ns.Dup(); !errors.Is(err, ErrClosed) {
+		t.Fatal("expecting ErrClosed from Dup but got", err)
+	}
+	if _, err := ns.File(); !errors.Is(err, ErrClosed) {
+		t.Fatal("expecting ErrClosed from File but got", err)
+	}
+	if _, err := ns.OwningUserNS(); !errors.Is(err, ErrClosed) {
+		t.Fatal("expecting ErrClosed from OwningUserNS but got", err)
+	}
+	if err := ns.Control(func(uintptr) {}); !errors.Is(err, ErrClosed) {
+		t.Fatal("expecting ErrClosed from Control but got", err)
+	}
+}
+
+func TestLeakFunc(t *testing.T) {
+	leaked := make(chan ID, 1)
+	SetLeakFunc(func(id ID, name string) {
+		leaked <- id
+	})
+	defer SetLeakFunc(nil)
+
+	ns, err := Self(NET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := ns.ID()
+	ns = nil
+
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+		select {
+		case got := <-leaked:
+			if got != id {
+				t.Fatalf("expecting leak of %s but got %s", id, got)
+			}
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("leaked namespace was not reported")
+}
+
+func TestThreadSelf(t *testing.T) {
+	nss, err := Unshare(NewMask().Set(NET))
+	if err != nil {
+		t.Fatal(err)
+	}
+	net := nss[NET]
+	defer net.Close()
+
+	errc := make(chan error, 1)
+	onLockedThread(func() bool {
+		errc <- func() error {
+			if err := net.Set(); err != nil {
+				return err
+			}
+			thrd, err := ThreadSelf(NET)
+			if err != nil {
+				return err
+			}
+			defer thrd.Close()
+			self, err := Self(NET)
+			if err != nil {
+				return err
+			}
+			defer self.Close()
+			tid, err := FromTID(os.Getpid(), unix.Gettid(), NET)
+			if err != nil {
+				return err
+			}
+			defer tid.Close()
+			if !thrd.Equal(net) || !tid.Equal(net) {
+				t.Error("thread should be in the new net ns")
+			}
+			if thrd.Equal(self) {
+				t.Error("thread and process net ns should differ")
+			}
+			return nil
+		}()
+		return false
+	})
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestForChildren(t *testing.T) {
+	pid, err := ForChildren(os.Getpid(), PID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pid.Close()
+	self, err := Self(PID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer self.Close()
+	if !pid.Equal(self) {
+		t.Fatal("children should be created in own pid ns")
+	}
+	if _, err := ForChildren(os.Getpid(), NET); !errors.Is(err, ErrNoForChildren) {
+		t.Fatal("expecting ErrNoForChildren but got", err)
+	}
+}
@@ -0,0 +1,123 @@
+package namespace
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// DialContext connects to addr on network from inside the network namespace ns. Host names are resolved in
+// the caller's namespace, only the connection is made from ns. The returned connection can be used from any
+// goroutine.
+func DialContext(ctx context.Context, ns *Namespace, network, addr string) (net.Conn, error) {
+	addrs, err := resolve(ctx, "dial", network, addr)
+	if err != nil {
+		return nil, err
+	}
+	var c net.Conn
+	err = inNet(ns, func() error {
+		d := &net.Dialer{
+			// the fallback would dial from another goroutine outside of ns
+			FallbackDelay: -1,
+		}
+		var err error
+		for _, a := range addrs {
+			if c, err = d.DialContext(ctx, network, a); err == nil {
+				return nil
+			}
+		}
+		return err
+	})
+	return c, err
+}
+
+// Listen announces on the local address addr from inside the network namespace ns, see net.Listen. The
+// returned listener can be used from any goroutine.
+func Listen(ns *Namespace, network, addr string) (net.Listener, error) {
+	addrs, err := resolve(context.Background(), "listen", network, addr)
+	if err != nil {
+		return nil, err
+	}
+	var l net.Listener
+	err = inNet(ns, func() error {
+		var err error
+		l, err = net.Listen(network, addrs[0])
+		return err
+	})
+	return l, err
+}
+
+// ListenPacket announces on the local address addr from inside the network namespace ns, see
+// net.ListenPacket. The returned connection can be used from any goroutine.
+func ListenPacket(ns *Namespace, network, addr string) (net.PacketConn, error) {
+	addrs, err := resolve(context.Background(), "listen", network, addr)
+	if err != nil {
+		return nil, err
+	}
+	var c net.PacketConn
+	err = inNet(ns, func() error {
+		var err error
+		c, err = net.ListenPacket(network, addrs[0])
+		return err
+	})
+	return c, err
+}
+
+// Socket creates a socket inside the network namespace ns, see socket(2). The returned file descriptor is
+// close on exec and has to be closed by the caller.
+func Socket(ns *Namespace, domain, typ, proto int) (int, error) {
+	fd := -1
+	err := inNet(ns, func() error {
+		var err error
+		fd, err = unix.Socket(domain, typ|unix.SOCK_CLOEXEC, proto)
+		return err
+	})
+	return fd, err
+}
+
+// inNet runs fn inside the network namespace ns and returns the error of fn as is
+func inNet(ns *Namespace, fn func() error) error {
+	return ns.doAs(NET, "socket", ErrNonNetNS, fn)
+}
+
+// resolve returns the addresses to try for addr with host names resolved to ip addresses. Addresses of
+// unix networks and ones without a host are returned as is.
+func resolve(ctx context.Context, op, network, addr string) ([]string, error) {
+	if strings.HasPrefix(network, "unix") {
+		return []string{addr}, nil
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, &net.OpError{Op: op, Net: network, Err: err}
+	}
+	if host == "" || net.ParseIP(host) != nil {
+		return []string{addr}, nil
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for _, ip := range ips {
+		if matchFamily(network, ip.IP) {
+			out = append(out, net.JoinHostPort(ip.String(), port))
+		}
+	}
+	if len(out) == 0 {
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+	return out, nil
+}
+
+// matchFamily is true if ip can be used with network e.g. tcp4
+func matchFamily(network string, ip net.IP) bool {
+	switch {
+	case strings.HasSuffix(network, "4"):
+		return ip.To4() != nil
+	case strings.HasSuffix(network, "6"):
+		return ip.To4() == nil
+	}
+	return true
+}
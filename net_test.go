@@ -0,0 +1,122 @@
+package namespace
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestDialListen(t *testing.T) {
+	ns, err := NewNetNS(NetNSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+
+	l, err := Listen(ns, "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		c.Write([]byte("hello"))
+		c.Close()
+	}()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	// the listener is not reachable from our namespace
+	if c, err := net.DialTimeout("tcp", l.Addr().String(), time.Second); err == nil {
+		c.Close()
+		t.Fatal("expecting dial outside of ns to fail")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := DialContext(ctx, ns, "tcp4", net.JoinHostPort("localhost", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	buf := make([]byte, 5)
+	if _, err := c.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Fatal("expecting hello but got", string(buf))
+	}
+}
+
+func TestListenPacket(t *testing.T) {
+	ns, err := NewNetNS(NetNSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+
+	pc, err := ListenPacket(ns, "udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	c, err := DialContext(context.Background(), ns, "udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4)
+	if _, _, err := pc.ReadFrom(buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "ping" {
+		t.Fatal("expecting ping but got", string(buf))
+	}
+}
+
+func TestSocket(t *testing.T) {
+	ns, err := NewNetNS(NetNSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+
+	fd, err := Socket(ns, unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unix.Close(fd)
+	// SIOCGSKNS returns the network namespace of the socket
+	nsfd, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), unix.SIOCGSKNS, 0)
+	if errno != 0 {
+		t.Fatal(errno)
+	}
+	sns, err := FromFD(int(nsfd), "socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sns.Close()
+	if !sns.Equal(ns) {
+		t.Fatalf("expecting socket in %s but got %s", ns.ID(), sns.ID())
+	}
+
+	uts, err := Self(UTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uts.Close()
+	if _, err := Socket(uts, unix.AF_INET, unix.SOCK_DGRAM, 0); !errors.Is(err, ErrNonNetNS) {
+		t.Fatal("expecting ErrNonNetNS but got", err)
+	}
+}
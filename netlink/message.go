@@ -0,0 +1,185 @@
+package netlink
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// veth attribute of IFLA_INFO_DATA holding the peer, not exported by x/sys/unix
+const vethInfoPeer = 1
+
+// nested attribute flag, not exported by x/sys/unix
+const nlaFNested = 0x8000
+
+func align(n int) int {
+	return (n + unix.NLMSG_ALIGNTO - 1) &^ (unix.NLMSG_ALIGNTO - 1)
+}
+
+// attr is a route attribute, possibly holding nested ones
+type attr struct {
+	typ      uint16
+	data     []byte
+	children []*attr
+}
+
+func newAttr(typ uint16, data []byte) *attr {
+	return &attr{
+		typ:  typ,
+		data: data,
+	}
+}
+
+func newAttrString(typ uint16, s string) *attr {
+	return newAttr(typ, append([]byte(s), 0))
+}
+
+func newAttrUint32(typ uint16, v uint32) *attr {
+	b := make([]byte, 4)
+	*(*uint32)(unsafe.Pointer(&b[0])) = v
+	return newAttr(typ, b)
+}
+
+func newAttrNested(typ uint16, children ...*attr) *attr {
+	return &attr{
+		typ:      typ | nlaFNested,
+		children: children,
+	}
+}
+
+func (a *attr) len() int {
+	l := unix.SizeofRtAttr + len(a.data)
+	for _, c := range a.children {
+		l = align(l) + c.len()
+	}
+	return l
+}
+
+// encode appends the attribute and its padding to b
+func (a *attr) encode(b []byte) []byte {
+	l := a.len()
+	hdr := make([]byte, unix.SizeofRtAttr)
+	rta := (*unix.RtAttr)(unsafe.Pointer(&hdr[0]))
+	rta.Len = uint16(l)
+	rta.Type = a.typ
+	b = append(b, hdr...)
+	b = append(b, a.data...)
+	for _, c := range a.children {
+		b = pad(b)
+		b = c.encode(b)
+	}
+	return pad(b)
+}
+
+func pad(b []byte) []byte {
+	return append(b, make([]byte, align(len(b))-len(b))...)
+}
+
+// request is a netlink message under construction
+type request struct {
+	typ   uint16
+	flags uint16
+	body  []byte
+}
+
+func newRequest(typ, flags uint16, body []byte) *request {
+	return &request{
+		typ:   typ,
+		flags: flags | unix.NLM_F_REQUEST,
+		body:  pad(body),
+	}
+}
+
+func (r *request) add(a *attr) {
+	r.body = a.encode(r.body)
+}
+
+func (r *request) encode(seq uint32) []byte {
+	b := make([]byte, unix.SizeofNlMsghdr, unix.SizeofNlMsghdr+len(r.body))
+	h := (*unix.NlMsghdr)(unsafe.Pointer(&b[0]))
+	h.Len = uint32(unix.SizeofNlMsghdr + len(r.body))
+	h.Type = r.typ
+	h.Flags = r.flags
+	h.Seq = seq
+	return append(b, r.body...)
+}
+
+func ifInfomsg(family uint8, index int32, flags, change uint32) []byte {
+	b := make([]byte, unix.SizeofIfInfomsg)
+	m := (*unix.IfInfomsg)(unsafe.Pointer(&b[0]))
+	m.Family = family
+	m.Index = index
+	m.Flags = flags
+	m.Change = change
+	return b
+}
+
+func ifAddrmsg(family, prefixlen uint8, index uint32) []byte {
+	b := make([]byte, unix.SizeofIfAddrmsg)
+	m := (*unix.IfAddrmsg)(unsafe.Pointer(&b[0]))
+	m.Family = family
+	m.Prefixlen = prefixlen
+	m.Index = index
+	return b
+}
+
+// message is a received netlink message
+type message struct {
+	hdr  unix.NlMsghdr
+	data []byte
+}
+
+// parseMessages splits b into netlink messages
+func parseMessages(b []byte) ([]message, error) {
+	out := []message{}
+	for len(b) >= unix.SizeofNlMsghdr {
+		h := *(*unix.NlMsghdr)(unsafe.Pointer(&b[0]))
+		l := int(h.Len)
+		if l < unix.SizeofNlMsghdr || l > len(b) {
+			return nil, unix.EINVAL
+		}
+		out = append(out, message{
+			hdr:  h,
+			data: b[unix.SizeofNlMsghdr:l],
+		})
+		if align(l) > len(b) {
+			break
+		}
+		b = b[align(l):]
+	}
+	return out, nil
+}
+
+// parseAttrs splits b into route attributes keyed by type, with the nested flag cleared
+func parseAttrs(b []byte) (map[uint16][]byte, error) {
+	out := map[uint16][]byte{}
+	for len(b) >= unix.SizeofRtAttr {
+		rta := *(*unix.RtAttr)(unsafe.Pointer(&b[0]))
+		l := int(rta.Len)
+		if l < unix.SizeofRtAttr || l > len(b) {
+			return nil, unix.EINVAL
+		}
+		out[rta.Type&^nlaFNested] = b[unix.SizeofRtAttr:l]
+		if align(l) > len(b) {
+			break
+		}
+		b = b[align(l):]
+	}
+	return out, nil
+}
+
+func attrString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+func attrUint32(b []byte) uint32 {
+	if len(b) < 4 {
+		return 0
+	}
+	return *(*uint32)(unsafe.Pointer(&b[0]))
+}
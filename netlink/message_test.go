@@ -0,0 +1,66 @@
+package netlink
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestAttrs(t *testing.T) {
+	b := newAttrString(unix.IFLA_IFNAME, "eth0").encode(nil)
+	b = newAttrNested(unix.IFLA_LINKINFO,
+		newAttrString(unix.IFLA_INFO_KIND, "veth"),
+		newAttrUint32(unix.IFLA_INFO_DATA, 7),
+	).encode(b)
+	if len(b)%unix.NLMSG_ALIGNTO != 0 {
+		t.Fatal("expecting aligned attributes but got length", len(b))
+	}
+
+	attrs, err := parseAttrs(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := attrString(attrs[unix.IFLA_IFNAME]); s != "eth0" {
+		t.Fatal("expecting eth0 but got", s)
+	}
+	nested, err := parseAttrs(attrs[unix.IFLA_LINKINFO])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := attrString(nested[unix.IFLA_INFO_KIND]); s != "veth" {
+		t.Fatal("expecting veth but got", s)
+	}
+	if v := attrUint32(nested[unix.IFLA_INFO_DATA]); v != 7 {
+		t.Fatal("expecting 7 but got", v)
+	}
+
+	if _, err := parseAttrs([]byte{0xff, 0, 1, 0}); err == nil {
+		t.Fatal("expecting error for truncated attribute")
+	}
+}
+
+func TestMessages(t *testing.T) {
+	req := newRequest(unix.RTM_GETLINK, unix.NLM_F_DUMP, ifInfomsg(unix.AF_UNSPEC, 3, 0, 0))
+	req.add(newAttrString(unix.IFLA_IFNAME, "lo"))
+	b := append(req.encode(1), req.encode(2)...)
+
+	msgs, err := parseMessages(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatal("expecting 2 messages but got", len(msgs))
+	}
+	for i, m := range msgs {
+		if m.hdr.Seq != uint32(i+1) || m.hdr.Type != unix.RTM_GETLINK || m.hdr.Flags&unix.NLM_F_REQUEST == 0 {
+			t.Fatalf("unexpected header %+v", m.hdr)
+		}
+		attrs, err := parseAttrs(m.data[unix.SizeofIfInfomsg:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := attrString(attrs[unix.IFLA_IFNAME]); s != "lo" {
+			t.Fatal("expecting lo but got", s)
+		}
+	}
+}
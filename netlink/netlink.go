@@ -0,0 +1,392 @@
+// Package netlink is a minimal rtnetlink client to inspect and configure the links and addresses of a network
+// namespace.
+package netlink
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"unsafe"
+
+	"github.com/thegrumpylion/namespace"
+	"golang.org/x/sys/unix"
+)
+
+// ErrLinkNotFound returned when there is no link with the requested name
+var ErrLinkNotFound = errors.New("link not found")
+
+// Link is a network interface
+type Link struct {
+	// Index of the link in its namespace
+	Index int
+	// Name of the link e.g. eth0
+	Name string
+	// Kind is the driver of the link e.g. veth, empty if the kernel doesn't report one
+	Kind string
+	// Flags of the link, see net.Interface
+	Flags net.Flags
+	// RawFlags are the IFF_* flags of the link
+	RawFlags uint32
+	// MTU of the link
+	MTU int
+	// HardwareAddr of the link, nil if it has none
+	HardwareAddr net.HardwareAddr
+}
+
+// Up is true if the link is administratively up
+func (l *Link) Up() bool {
+	return l.RawFlags&unix.IFF_UP != 0
+}
+
+// Addr is an ip address of a link
+type Addr struct {
+	// LinkIndex is the index of the link the address is assigned to
+	LinkIndex int
+	// IPNet is the address and its prefix
+	IPNet *net.IPNet
+	// Label of the address, ipv4 only
+	Label string
+}
+
+// Handle is a rtnetlink socket created inside a network namespace. Every request acts on that namespace,
+// no matter which thread makes it. A Handle is safe for concurrent use.
+type Handle struct {
+	mu  sync.Mutex
+	fd  int
+	seq uint32
+}
+
+// NewHandle returns a Handle for the network namespace ns, or the caller's if ns is nil
+func NewHandle(ns *namespace.Namespace) (*Handle, error) {
+	var fd int
+	var err error
+	if ns == nil {
+		fd, err = unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	} else {
+		fd, err = namespace.Socket(ns, unix.AF_NETLINK, unix.SOCK_RAW, unix.NETLINK_ROUTE)
+	}
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	return &Handle{
+		fd: fd,
+	}, nil
+}
+
+// Close closes the netlink socket
+func (h *Handle) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.fd < 0 {
+		return nil
+	}
+	err := unix.Close(h.fd)
+	h.fd = -1
+	return err
+}
+
+// execute sends req and returns the data of the replies. Requests without NLM_F_DUMP are acked.
+func (h *Handle) execute(op string, req *request) ([][]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.fd < 0 {
+		return nil, os.NewSyscallError(op, unix.EBADF)
+	}
+	dump := req.flags&unix.NLM_F_DUMP == unix.NLM_F_DUMP
+	if !dump {
+		req.flags |= unix.NLM_F_ACK
+	}
+	h.seq++
+	if err := unix.Sendto(h.fd, req.encode(h.seq), 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return nil, os.NewSyscallError(op, err)
+	}
+
+	out := [][]byte{}
+	buf := make([]byte, os.Getpagesize()*8)
+	for {
+		n, _, err := unix.Recvfrom(h.fd, buf, 0)
+		if err != nil {
+			return nil, os.NewSyscallError(op, err)
+		}
+		msgs, err := parseMessages(buf[:n])
+		if err != nil {
+			return nil, os.NewSyscallError(op, err)
+		}
+		for _, m := range msgs {
+			if m.hdr.Seq != h.seq {
+				continue
+			}
+			switch m.hdr.Type {
+			case unix.NLMSG_DONE:
+				return out, nil
+			case unix.NLMSG_ERROR:
+				if len(m.data) < 4 {
+					return nil, os.NewSyscallError(op, unix.EINVAL)
+				}
+				if errno := -int32(attrUint32(m.data)); errno != 0 {
+					return nil, os.NewSyscallError(op, unix.Errno(errno))
+				}
+				return out, nil
+			}
+			// copy as buf is reused
+			out = append(out, append([]byte{}, m.data...))
+		}
+	}
+}
+
+// Links returns all links of the namespace
+func (h *Handle) Links() ([]*Link, error) {
+	msgs, err := h.execute("get links", newRequest(unix.RTM_GETLINK, unix.NLM_F_DUMP, ifInfomsg(unix.AF_UNSPEC, 0, 0, 0)))
+	if err != nil {
+		return nil, err
+	}
+	out := []*Link{}
+	for _, m := range msgs {
+		l, err := parseLink(m)
+		if err != nil {
+			return nil, os.NewSyscallError("get links", err)
+		}
+		out = append(out, l)
+	}
+	return out, nil
+}
+
+// LinkByName returns the link with name. ErrLinkNotFound if there is none
+func (h *Handle) LinkByName(name string) (*Link, error) {
+	req := newRequest(unix.RTM_GETLINK, 0, ifInfomsg(unix.AF_UNSPEC, 0, 0, 0))
+	req.add(newAttrString(unix.IFLA_IFNAME, name))
+	msgs, err := h.execute("get link", req)
+	if errors.Is(err, unix.ENODEV) || err == nil && len(msgs) == 0 {
+		return nil, ErrLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	l, err := parseLink(msgs[0])
+	if err != nil {
+		return nil, os.NewSyscallError("get link", err)
+	}
+	return l, nil
+}
+
+func parseLink(b []byte) (*Link, error) {
+	if len(b) < unix.SizeofIfInfomsg {
+		return nil, unix.EINVAL
+	}
+	info := *(*unix.IfInfomsg)(unsafe.Pointer(&b[0]))
+	attrs, err := parseAttrs(b[unix.SizeofIfInfomsg:])
+	if err != nil {
+		return nil, err
+	}
+	l := &Link{
+		Index:    int(info.Index),
+		Name:     attrString(attrs[unix.IFLA_IFNAME]),
+		RawFlags: info.Flags,
+		Flags:    linkFlags(info.Flags),
+		MTU:      int(attrUint32(attrs[unix.IFLA_MTU])),
+	}
+	if a := attrs[unix.IFLA_ADDRESS]; len(a) > 0 {
+		l.HardwareAddr = append(net.HardwareAddr{}, a...)
+	}
+	if li, ok := attrs[unix.IFLA_LINKINFO]; ok {
+		nested, err := parseAttrs(li)
+		if err != nil {
+			return nil, err
+		}
+		l.Kind = attrString(nested[unix.IFLA_INFO_KIND])
+	}
+	return l, nil
+}
+
+// linkFlags converts IFF_* flags as net.Interface does
+func linkFlags(raw uint32) net.Flags {
+	var f net.Flags
+	if raw&unix.IFF_UP != 0 {
+		f |= net.FlagUp
+	}
+	if raw&unix.IFF_BROADCAST != 0 {
+		f |= net.FlagBroadcast
+	}
+	if raw&unix.IFF_LOOPBACK != 0 {
+		f |= net.FlagLoopback
+	}
+	if raw&unix.IFF_POINTOPOINT != 0 {
+		f |= net.FlagPointToPoint
+	}
+	if raw&unix.IFF_MULTICAST != 0 {
+		f |= net.FlagMulticast
+	}
+	return f
+}
+
+// Addrs returns the addresses of the link with index, or of all links if index is 0
+func (h *Handle) Addrs(index int) ([]*Addr, error) {
+	msgs, err := h.execute("get addrs", newRequest(unix.RTM_GETADDR, unix.NLM_F_DUMP, ifAddrmsg(unix.AF_UNSPEC, 0, 0)))
+	if err != nil {
+		return nil, err
+	}
+	out := []*Addr{}
+	for _, m := range msgs {
+		a, err := parseAddr(m)
+		if err != nil {
+			return nil, os.NewSyscallError("get addrs", err)
+		}
+		if index == 0 || a.LinkIndex == index {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+func parseAddr(b []byte) (*Addr, error) {
+	if len(b) < unix.SizeofIfAddrmsg {
+		return nil, unix.EINVAL
+	}
+	msg := *(*unix.IfAddrmsg)(unsafe.Pointer(&b[0]))
+	attrs, err := parseAttrs(b[unix.SizeofIfAddrmsg:])
+	if err != nil {
+		return nil, err
+	}
+	// IFA_LOCAL is the address of the interface, IFA_ADDRESS the peer for point to point links
+	ip := attrs[unix.IFA_LOCAL]
+	if ip == nil {
+		ip = attrs[unix.IFA_ADDRESS]
+	}
+	bits := 8 * net.IPv4len
+	if msg.Family == unix.AF_INET6 {
+		bits = 8 * net.IPv6len
+	}
+	return &Addr{
+		LinkIndex: int(msg.Index),
+		IPNet: &net.IPNet{
+			IP:   append(net.IP{}, ip...),
+			Mask: net.CIDRMask(int(msg.Prefixlen), bits),
+		},
+		Label: attrString(attrs[unix.IFA_LABEL]),
+	}, nil
+}
+
+// SetLinkUp brings the link with name up
+func (h *Handle) SetLinkUp(name string) error {
+	return h.setFlags("set link up", name, unix.IFF_UP, unix.IFF_UP)
+}
+
+// SetLinkDown brings the link with name down
+func (h *Handle) SetLinkDown(name string) error {
+	return h.setFlags("set link down", name, 0, unix.IFF_UP)
+}
+
+func (h *Handle) setFlags(op, name string, flags, change uint32) error {
+	l, err := h.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	_, err = h.execute(op, newRequest(unix.RTM_NEWLINK, 0, ifInfomsg(unix.AF_UNSPEC, int32(l.Index), flags, change)))
+	return err
+}
+
+// AddAddr assigns the ipv4 or ipv6 address ipnet to the link with name
+func (h *Handle) AddAddr(name string, ipnet *net.IPNet) error {
+	l, err := h.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	family := uint8(unix.AF_INET6)
+	ip := ipnet.IP.To16()
+	if ip4 := ipnet.IP.To4(); ip4 != nil {
+		family = unix.AF_INET
+		ip = ip4
+	}
+	if ip == nil {
+		return os.NewSyscallError("add addr", unix.EINVAL)
+	}
+	ones, _ := ipnet.Mask.Size()
+	req := newRequest(unix.RTM_NEWADDR, unix.NLM_F_CREATE|unix.NLM_F_EXCL, ifAddrmsg(family, uint8(ones), uint32(l.Index)))
+	req.add(newAttr(unix.IFA_LOCAL, ip))
+	req.add(newAttr(unix.IFA_ADDRESS, ip))
+	_, err = h.execute("add addr", req)
+	return err
+}
+
+// SetLinkNS moves the link with name into the network namespace ns. The link keeps its name and is down
+// in ns.
+func (h *Handle) SetLinkNS(name string, ns *namespace.Namespace) error {
+	if err := checkNetNS("set link ns", ns); err != nil {
+		return err
+	}
+	l, err := h.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	// the fd is only valid while ns is held open
+	cerr := ns.Control(func(fd uintptr) {
+		req := newRequest(unix.RTM_NEWLINK, 0, ifInfomsg(unix.AF_UNSPEC, int32(l.Index), 0, 0))
+		req.add(newAttrUint32(unix.IFLA_NET_NS_FD, uint32(fd)))
+		_, err = h.execute("set link ns", req)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// AddVeth creates a veth pair with one end named name in the namespace of the handle and the other named
+// peer in the network namespace peerNS, or next to the first if peerNS is nil. Both ends are down.
+func (h *Handle) AddVeth(name, peer string, peerNS *namespace.Namespace) error {
+	if peerNS == nil {
+		return h.addVeth(name, peer, -1)
+	}
+	if err := checkNetNS("add veth", peerNS); err != nil {
+		return err
+	}
+	var err error
+	cerr := peerNS.Control(func(fd uintptr) {
+		err = h.addVeth(name, peer, int(fd))
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// addVeth creates the veth pair with the peer in the namespace of fd, or next to the first end if -1
+func (h *Handle) addVeth(name, peer string, fd int) error {
+	peerAttrs := ifInfomsg(unix.AF_UNSPEC, 0, 0, 0)
+	peerAttrs = newAttrString(unix.IFLA_IFNAME, peer).encode(peerAttrs)
+	if fd != -1 {
+		peerAttrs = newAttrUint32(unix.IFLA_NET_NS_FD, uint32(fd)).encode(peerAttrs)
+	}
+	req := newRequest(unix.RTM_NEWLINK, unix.NLM_F_CREATE|unix.NLM_F_EXCL, ifInfomsg(unix.AF_UNSPEC, 0, 0, 0))
+	req.add(newAttrString(unix.IFLA_IFNAME, name))
+	req.add(newAttrNested(unix.IFLA_LINKINFO,
+		newAttrString(unix.IFLA_INFO_KIND, "veth"),
+		newAttrNested(unix.IFLA_INFO_DATA,
+			newAttr(vethInfoPeer, peerAttrs),
+		),
+	))
+	_, err := h.execute("add veth", req)
+	return err
+}
+
+// checkNetNS returns a *namespace.NamespaceError for op if ns is not a network namespace
+func checkNetNS(op string, ns *namespace.Namespace) error {
+	if ns.Type() != namespace.NET {
+		return namespace.NewError(op, ns.FileName(), ns.Type(), namespace.ErrNonNetNS)
+	}
+	return nil
+}
+
+// DeleteLink removes the link with name. Deleting one end of a veth pair removes both.
+func (h *Handle) DeleteLink(name string) error {
+	l, err := h.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	_, err = h.execute("delete link", newRequest(unix.RTM_DELLINK, 0, ifInfomsg(unix.AF_UNSPEC, int32(l.Index), 0, 0)))
+	return err
+}
@@ -0,0 +1,185 @@
+package netlink
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/thegrumpylion/namespace"
+)
+
+func newHandle(t *testing.T, ns *namespace.Namespace) *Handle {
+	h, err := NewHandle(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestLinks(t *testing.T) {
+	ns, err := namespace.NewNetNS(namespace.NetNSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+	h := newHandle(t, ns)
+	defer h.Close()
+
+	links, err := h.Links()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 || links[0].Name != "lo" {
+		t.Fatalf("expecting only lo in new ns but got %+v", links)
+	}
+	if err := h.SetLinkDown("lo"); err != nil {
+		t.Fatal(err)
+	}
+	if lo, err := h.LinkByName("lo"); err != nil || lo.Up() {
+		t.Fatal("expecting lo to be down but got", lo, err)
+	}
+	if err := h.SetLinkUp("lo"); err != nil {
+		t.Fatal(err)
+	}
+	lo, err := h.LinkByName("lo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lo.Up() || lo.Flags&net.FlagLoopback == 0 {
+		t.Fatalf("expecting lo to be an up loopback but got %+v", lo)
+	}
+	addrs, err := h.Addrs(lo.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, a := range addrs {
+		if a.IPNet.String() == "127.0.0.1/8" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expecting 127.0.0.1/8 on lo but got %v", addrs)
+	}
+	if _, err := h.LinkByName("nope0"); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatal("expecting ErrLinkNotFound but got", err)
+	}
+}
+
+func TestVeth(t *testing.T) {
+	nsA, err := namespace.NewNetNS(namespace.NetNSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nsA.Close()
+	nsB, err := namespace.NewNetNS(namespace.NetNSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nsB.Close()
+	ha := newHandle(t, nsA)
+	defer ha.Close()
+	hb := newHandle(t, nsB)
+	defer hb.Close()
+
+	uts, err := namespace.Self(namespace.UTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uts.Close()
+	if err := ha.AddVeth("veth0", "veth1", uts); !errors.Is(err, namespace.ErrNonNetNS) {
+		t.Fatal("expecting ErrNonNetNS but got", err)
+	}
+	closed, err := nsB.Dup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+	if err := ha.AddVeth("veth0", "veth1", closed); !errors.Is(err, namespace.ErrClosed) {
+		t.Fatal("expecting ErrClosed but got", err)
+	}
+
+	if err := ha.AddVeth("veth0", "veth1", nsB); err != nil {
+		t.Fatal(err)
+	}
+	l, err := ha.LinkByName("veth0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Kind != "veth" {
+		t.Fatal("expecting kind veth but got", l.Kind)
+	}
+	if _, err := ha.LinkByName("veth1"); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatal("expecting peer not in ns A but got", err)
+	}
+	if _, err := hb.LinkByName("veth1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, h := range []*Handle{ha, hb} {
+		name := "veth0"
+		ips := []string{"10.0.0.1/24", "fd00::1/64"}
+		if h == hb {
+			name = "veth1"
+			ips = []string{"10.0.0.2/24", "fd00::2/64"}
+		}
+		for _, s := range ips {
+			ip, ipnet, _ := net.ParseCIDR(s)
+			ipnet.IP = ip
+			if err := h.AddAddr(name, ipnet); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := h.SetLinkUp(name); err != nil {
+			t.Fatal(err)
+		}
+		l, err := h.LinkByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs, err := h.Addrs(l.Index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]bool{}
+		for _, a := range addrs {
+			got[a.IPNet.String()] = true
+		}
+		for _, s := range ips {
+			if !got[s] {
+				t.Fatalf("expecting %s on %s but got %v", s, name, addrs)
+			}
+		}
+	}
+
+	// move a second pair's end from A to B
+	if err := ha.AddVeth("veth2", "veth3", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ha.SetLinkNS("veth3", uts); !errors.Is(err, namespace.ErrNonNetNS) {
+		t.Fatal("expecting ErrNonNetNS but got", err)
+	}
+	if err := ha.SetLinkNS("veth3", closed); !errors.Is(err, namespace.ErrClosed) {
+		t.Fatal("expecting ErrClosed but got", err)
+	}
+	if err := ha.SetLinkNS("veth3", nsB); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hb.LinkByName("veth3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ha.LinkByName("veth3"); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatal("expecting veth3 moved out of ns A but got", err)
+	}
+
+	if err := hb.DeleteLink("veth1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ha.LinkByName("veth0"); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatal("expecting veth0 deleted with its peer but got", err)
+	}
+	if err := ha.AddVeth("veth2", "veth4", nil); !errors.Is(err, syscall.EEXIST) {
+		t.Fatal("expecting EEXIST but got", err)
+	}
+}
@@ -0,0 +1,68 @@
+package namespace
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// NetNSOptions configure the namespace created by NewNetNS
+type NetNSOptions struct {
+	// Sysctls are written inside the new namespace with WriteSysctl e.g. net.ipv4.ip_forward
+	Sysctls map[string]string
+}
+
+// NewNetNS creates a network namespace with the loopback interface up and opts applied. Unlike Unshare the
+// namespace is ready to use e.g. to be persisted in a store.Store.
+func NewNetNS(opts NetNSOptions) (*Namespace, error) {
+	nss, err := Unshare(NewMask().Set(NET))
+	if err != nil {
+		return nil, err
+	}
+	ns := nss[NET]
+	if err := ns.setLinkUp("lo"); err != nil {
+		ns.Close()
+		return nil, err
+	}
+	for k, v := range opts.Sysctls {
+		if err := WriteSysctl(ns, k, v); err != nil {
+			ns.Close()
+			return nil, err
+		}
+	}
+	return ns, nil
+}
+
+// ifreqFlags is struct ifreq with the ifr_flags member of the union, not exported by x/sys/unix
+type ifreqFlags struct {
+	name  [unix.IFNAMSIZ]byte
+	flags uint16
+	_     [22]byte
+}
+
+// setLinkUp sets IFF_UP on the interface with name in the network namespace ns
+func (ns *Namespace) setLinkUp(name string) error {
+	fd, err := Socket(ns, unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	req := ifreqFlags{}
+	copy(req.name[:unix.IFNAMSIZ-1], name)
+	if err := ioctlIfreq(fd, unix.SIOCGIFFLAGS, &req); err != nil {
+		return ns.error("link up "+name, err)
+	}
+	req.flags |= unix.IFF_UP
+	if err := ioctlIfreq(fd, unix.SIOCSIFFLAGS, &req); err != nil {
+		return ns.error("link up "+name, err)
+	}
+	return nil
+}
+
+func ioctlIfreq(fd int, req uint, ifr *ifreqFlags) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), uintptr(req), uintptr(unsafe.Pointer(ifr)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
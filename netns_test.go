@@ -0,0 +1,76 @@
+package namespace
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestNewNetNS(t *testing.T) {
+	ns, err := NewNetNS(NetNSOptions{
+		Sysctls: map[string]string{
+			"net.ipv4.ip_forward": "1",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+	self, err := Self(NET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer self.Close()
+	if ns.Equal(self) {
+		t.Fatal("expecting a new net ns")
+	}
+
+	// loopback is usable right away
+	l, err := Listen(ns, "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			c.Close()
+		}
+	}()
+	c, err := DialContext(context.Background(), ns, "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	var fwd []byte
+	err = ns.Do(func() error {
+		var err error
+		fwd, err = ioutil.ReadFile("/proc/sys/net/ipv4/ip_forward")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(fwd)) != "1" {
+		t.Fatal("expecting ip_forward 1 but got", string(fwd))
+	}
+	if err := ns.Do(func() error {
+		ifi, err := net.InterfaceByName("lo")
+		if err != nil {
+			return err
+		}
+		if ifi.Flags&net.FlagUp == 0 {
+			t.Error("expecting lo to be up")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewNetNS(NetNSOptions{Sysctls: map[string]string{"net.nope": "1"}}); err == nil {
+		t.Fatal("expecting error for unknown sysctl")
+	}
+}
@@ -0,0 +1,59 @@
+package namespace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ProcessOwnership returns the owners of every namespace of process pid, with ID, PID, Owner and OwnerUID of the
+// Info set. Types the kernel doesn't support are left out. Needs procfs.
+func ProcessOwnership(pid int) (map[Type]*Info, error) {
+	out := map[Type]*Info{}
+	for _, t := range Types() {
+		ns, err := FromPID(pid, t)
+		if errors.Is(err, os.ErrNotExist) {
+			// the process is there but the namespace type is not
+			if _, serr := os.Stat(filepath.Join(PROCFSPath, strconv.Itoa(pid), "ns")); serr == nil {
+				continue
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		inf := &Info{
+			ID:  ns.ID(),
+			PID: pid,
+		}
+		inf.Owner, inf.OwnerUID, err = ownership(ns)
+		ns.Close()
+		if err != nil {
+			return nil, err
+		}
+		out[t] = inf
+	}
+	return out, nil
+}
+
+// ownership returns the owning user namespace of ns and the uid of the creator as Info has them. An
+// owner outside of the caller's namespace scope is not an error.
+func ownership(ns *Namespace) (ID, int, error) {
+	owner, err := ns.OwningUserNS()
+	if errors.Is(err, ErrNotPermitted) {
+		return ID{}, -1, nil
+	}
+	if err != nil {
+		return ID{}, -1, err
+	}
+	defer owner.Close()
+	uidNS := owner
+	if ns.Type() == USER {
+		uidNS = ns
+	}
+	uid, err := uidNS.OwnerUID()
+	if err != nil {
+		return ID{}, -1, err
+	}
+	return owner.ID(), uid, nil
+}
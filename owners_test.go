@@ -0,0 +1,48 @@
+package namespace
+
+import (
+	"os"
+	"testing"
+)
+
+func TestProcessOwnership(t *testing.T) {
+	m := NewMask().Set(USER).Set(NET).Set(UTS)
+
+	c, err := newProcess(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+
+	ppid := c.Process.Pid
+
+	own, err := ProcessOwnership(ppid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(own) != len(Types()) {
+		t.Fatalf("expecting %d entries but got %d", len(Types()), len(own))
+	}
+
+	selfUser, err := Self(USER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer selfUser.Close()
+
+	usr := own[USER]
+	if !usr.Owner.Equal(selfUser.ID()) {
+		t.Fatalf("child user ns should be owned by %s instead of %s", selfUser.ID(), usr.Owner)
+	}
+	for _, nsType := range []Type{NET, UTS} {
+		if !own[nsType].Owner.Equal(usr.ID) {
+			t.Fatalf("%s should be owned by %s instead of %s", nsType, usr.ID, own[nsType].Owner)
+		}
+		if own[nsType].OwnerUID != os.Getuid() {
+			t.Fatalf("expecting owner uid %d but got %d", os.Getuid(), own[nsType].OwnerUID)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package namespace
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// inode number of the root of a procfs
+const procRootIno = 1
+
+// Proc is an open procfs mount. Namespaces are looked up relative to it, so one process can use several procfs
+// mounts, e.g. the one of another pid namespace mounted at /host/proc, concurrently. It is safe for concurrent use.
+type Proc struct {
+	path   string
+	file   *os.File
+	mu     sync.RWMutex
+	closed bool
+}
+
+// OpenProc opens the procfs mounted at path. It fails with ErrNotProcfs if path is not the root of a procfs
+func OpenProc(path string) (*Proc, error) {
+	path = filepath.Clean(path)
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, NewError("open", path, INVALID, err)
+	}
+	f := os.NewFile(uintptr(fd), path)
+	var st unix.Statfs_t
+	if err := unix.Fstatfs(fd, &st); err != nil {
+		f.Close()
+		return nil, NewError("statfs", path, INVALID, err)
+	}
+	if st.Type != unix.PROC_SUPER_MAGIC {
+		f.Close()
+		return nil, NewError("statfs", path, INVALID, ErrNotProcfs)
+	}
+	// any directory in a procfs passes the magic check, e.g. /proc/self. only the root has inode 1
+	var stat unix.Stat_t
+	if err := unix.Fstat(fd, &stat); err != nil {
+		f.Close()
+		return nil, NewError("stat", path, INVALID, err)
+	}
+	if stat.Ino != procRootIno {
+		f.Close()
+		return nil, NewError("stat", path, INVALID, ErrNotProcfs)
+	}
+	return &Proc{
+		path: path,
+		file: f,
+	}, nil
+}
+
+// Path returns the path the procfs was opened from
+func (p *Proc) Path() string {
+	return p.path
+}
+
+// Close the procfs. Closing a closed Proc does nothing.
+func (p *Proc) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	if err := p.file.Close(); err != nil {
+		return NewError("close", p.path, INVALID, err)
+	}
+	return nil
+}
+
+// FromPID return a new namspace for a PID and Type. The pid is in the pid namespace of the procfs
+func (p *Proc) FromPID(pid int, t Type) (*Namespace, error) {
+	return p.open(filepath.Join(strconv.Itoa(pid), "ns", t.StringLower()), t)
+}
+
+// FromTID return a new namspace of Type for thread tid of process pid. The ids are in the pid namespace of the procfs
+func (p *Proc) FromTID(pid, tid int, t Type) (*Namespace, error) {
+	return p.open(filepath.Join(strconv.Itoa(pid), "task", strconv.Itoa(tid), "ns", t.StringLower()), t)
+}
+
+// Self return a new namspace of type t of the caller. Only works if the caller is in the pid namespace of the procfs
+func (p *Proc) Self(t Type) (*Namespace, error) {
+	return p.open(filepath.Join("self", "ns", t.StringLower()), t)
+}
+
+// ThreadSelf return a new namspace of type t of the calling thread. See ThreadSelf
+func (p *Proc) ThreadSelf(t Type) (*Namespace, error) {
+	return p.open(filepath.Join("thread-self", "ns", t.StringLower()), t)
+}
+
+// ForChildren return a new namspace of type t, PID or TIME, that children of process pid are created in. See ForChildren
+func (p *Proc) ForChildren(pid int, t Type) (*Namespace, error) {
+	name, err := forChildrenName(t)
+	if err != nil {
+		return nil, err
+	}
+	return p.open(filepath.Join(strconv.Itoa(pid), "ns", name), t)
+}
+
+// open returns the namespace at name relative to the procfs root
+func (p *Proc) open(name string, t Type) (*Namespace, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	pth := filepath.Join(p.path, name)
+	if p.closed {
+		return nil, NewError("open", pth, t, ErrClosed)
+	}
+	fd, err := unix.Openat(int(p.file.Fd()), name, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, NewError("open", pth, t, err)
+	}
+	f := os.NewFile(uintptr(fd), pth)
+	ns, err := FromFile(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return ns, nil
+}
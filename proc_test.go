@@ -0,0 +1,82 @@
+package namespace
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestProc(t *testing.T) {
+	if _, err := OpenProc(t.TempDir()); !errors.Is(err, ErrNotProcfs) {
+		t.Fatal("expecting ErrNotProcfs but got", err)
+	}
+	if _, err := OpenProc(filepath.Join(PROCFSPath, "self")); !errors.Is(err, ErrNotProcfs) {
+		t.Fatal("expecting ErrNotProcfs for a directory in procfs but got", err)
+	}
+
+	p, err := OpenProc(PROCFSPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	m := NewMask().Set(NET).Set(UTS)
+
+	c, err := newProcess(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+
+	ppid := c.Process.Pid
+
+	wg := sync.WaitGroup{}
+	for _, nsType := range Types() {
+		wg.Add(1)
+		go func(nsType Type) {
+			defer wg.Done()
+			ns, err := p.FromPID(ppid, nsType)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer ns.Close()
+			exp, err := FromPID(ppid, nsType)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer exp.Close()
+			if !ns.Equal(exp) {
+				t.Errorf("expecting %s but got %s", exp.ID(), ns.ID())
+			}
+		}(nsType)
+	}
+	wg.Wait()
+
+	self, err := p.Self(NET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer self.Close()
+	thrd, err := p.FromTID(os.Getpid(), unix.Gettid(), NET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer thrd.Close()
+	if !self.Equal(thrd) {
+		t.Fatal("thread should be in the net ns of the process")
+	}
+
+	p.Close()
+	if _, err := p.Self(NET); !errors.Is(err, ErrClosed) {
+		t.Fatal("expecting ErrClosed but got", err)
+	}
+}
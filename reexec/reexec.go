@@ -0,0 +1,369 @@
+// Package reexec runs registered functions in a new process of the current executable, inside namespaces the
+// calling process can't safely enter itself.
+//
+// The new process is started with namespace.StartProcess, which joins the namespaces before exec while the child
+// is still single threaded, so namespaces of any type, including user and time, apply to the whole process and
+// Init runs the function right away. When the process is created in a new user namespace instead it joins the
+// namespaces from Init with namespace.Do, where user and time fail with namespace.ErrSingleThreaded.
+package reexec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"github.com/thegrumpylion/namespace"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	envName  = "_NAMESPACE_REEXEC"
+	envNsFds = "_NAMESPACE_REEXEC_NSFDS"
+	envExec  = "_NAMESPACE_REEXEC_EXEC"
+)
+
+// fds of the new process, following stdio
+const (
+	syncFd = 3 + iota
+	argFd
+	resultFd
+	nsFd
+)
+
+const (
+	resultOK byte = iota
+	resultErr
+)
+
+// Func is a function that can be run in a new process by Cmd. The result and error are returned by Cmd.Run
+type Func func(arg []byte) ([]byte, error)
+
+var (
+	mu    sync.RWMutex
+	funcs = map[string]Func{}
+)
+
+// Register makes fn available to Cmd under name. Panics if name is already registered. It is meant to be called
+// from package init so the function is also registered in the new process.
+func Register(name string, fn Func) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := funcs[name]; ok {
+		panic("reexec: function registered twice: " + name)
+	}
+	funcs[name] = fn
+}
+
+// Init runs the registered function and exits if the process was started by Cmd, otherwise it returns. It has to
+// be called first thing in main, or in TestMain for tests.
+func Init() {
+	name, ok := os.LookupEnv(envName)
+	if !ok {
+		return
+	}
+	res := os.NewFile(resultFd, "result")
+	out, err := run(name)
+	if err != nil {
+		res.Write(append([]byte{resultErr}, err.Error()...))
+		os.Exit(1)
+	}
+	res.Write(append([]byte{resultOK}, out...))
+	os.Exit(0)
+}
+
+func run(name string) ([]byte, error) {
+	// the parent closes its end once Setup is done. reading it again after exec returns EOF right away
+	if _, err := ioutil.ReadAll(os.NewFile(syncFd, "sync")); err != nil {
+		return nil, err
+	}
+	if os.Getenv(envExec) != "" {
+		// the process was started in a new user namespace before Setup wrote its id maps so exec
+		// dropped all capabilities. now that it is mapped, exec again to get them back.
+		os.Unsetenv(envExec)
+		return nil, unix.Exec("/proc/self/exe", os.Args, os.Environ())
+	}
+	nfds, _ := strconv.Atoi(os.Getenv(envNsFds))
+	// processes started by the function are not for us
+	os.Unsetenv(envName)
+	os.Unsetenv(envNsFds)
+
+	mu.RLock()
+	fn, ok := funcs[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("reexec: function not registered: %s", name)
+	}
+	arg, err := ioutil.ReadAll(os.NewFile(argFd, "arg"))
+	if err != nil {
+		return nil, err
+	}
+	if nfds == 0 {
+		// the whole process is inside the namespaces already
+		return fn(arg)
+	}
+	nss := []*namespace.Namespace{}
+	for i := 0; i < nfds; i++ {
+		ns, err := namespace.FromFD(nsFd+i, "ns:"+strconv.Itoa(i))
+		if err != nil {
+			return nil, err
+		}
+		defer ns.Close()
+		nss = append(nss, ns)
+	}
+	var out []byte
+	err = namespace.Do(func() error {
+		var err error
+		out, err = fn(arg)
+		return err
+	}, nss...)
+	var derr *namespace.DoError
+	if errors.As(err, &derr) && derr.Step == namespace.StepRun {
+		err = derr.Err
+	}
+	return out, err
+}
+
+// Cmd runs a registered function in a new process of the current executable
+type Cmd struct {
+	// Name of the registered function
+	Name string
+	// Arg is passed to the function
+	Arg []byte
+	// Namespaces the process joins before running the function. They are joined before exec, see
+	// namespace.StartProcess, unless Unshare has USER. Then the process joins them from a dedicated thread as with
+	// namespace.Do so user and time fail with namespace.ErrSingleThreaded
+	Namespaces []*namespace.Namespace
+	// Unshare has the types of new namespaces of the process. With USER the process is created in them, see
+	// namespace.Cmd, otherwise they are created after joining Namespaces. Either way the process runs the function
+	// inside them, as init of a new pid namespace
+	Unshare namespace.Mask
+	// UidMappings and GidMappings are written for a new user namespace
+	UidMappings []syscall.SysProcIDMap
+	GidMappings []syscall.SysProcIDMap
+	// Setup, if set, is called with the pid of the process after it started and before it joins Namespaces and
+	// runs the function, e.g. to write the id maps of a new user namespace with a helper. The process execs
+	// itself once more after Setup in that case to regain its capabilities in the new user namespace
+	Setup func(pid int) error
+	// Stdout and Stderr of the process, discarded if nil
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Command returns a Cmd to run the function registered as name with arg inside nss
+func Command(name string, arg []byte, nss ...*namespace.Namespace) *Cmd {
+	return &Cmd{
+		Name:       name,
+		Arg:        arg,
+		Namespaces: nss,
+	}
+}
+
+// Run starts the process, waits for it and returns the result of the function
+func (c *Cmd) Run() ([]byte, error) {
+	extra := []*os.File{}
+	closeExtra := func() {
+		for _, f := range extra {
+			f.Close()
+		}
+	}
+	syncR, syncW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer syncW.Close()
+	extra = append(extra, syncR)
+	argR, argW, err := os.Pipe()
+	if err != nil {
+		closeExtra()
+		return nil, err
+	}
+	defer argW.Close()
+	extra = append(extra, argR)
+	resR, resW, err := os.Pipe()
+	if err != nil {
+		closeExtra()
+		return nil, err
+	}
+	defer resR.Close()
+	extra = append(extra, resW)
+
+	var p *os.Process
+	var wait func() error
+	if c.Unshare.Has(namespace.USER) {
+		p, wait, err = c.startUnshared(extra)
+	} else {
+		p, wait, err = c.startJoined(extra)
+	}
+	// the child has its own copies now
+	closeExtra()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Setup != nil {
+		if err := c.Setup(p.Pid); err != nil {
+			p.Kill()
+			wait()
+			return nil, err
+		}
+	}
+	syncW.Close()
+	if _, err := argW.Write(c.Arg); err != nil {
+		p.Kill()
+		wait()
+		return nil, err
+	}
+	argW.Close()
+
+	res, err := ioutil.ReadAll(resR)
+	werr := wait()
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		if werr == nil {
+			werr = errors.New("reexec: no result")
+		}
+		return nil, werr
+	}
+	if res[0] == resultErr {
+		return nil, errors.New(string(res[1:]))
+	}
+	return bytes.TrimPrefix(res, []byte{resultOK}), nil
+}
+
+// startJoined starts the process inside Namespaces with namespace.StartProcess. extra follows stdio.
+func (c *Cmd) startJoined(extra []*os.File) (*os.Process, func() error, error) {
+	exe, err := os.Open("/proc/self/exe")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer exe.Close()
+	// files of the child only, closed once it started
+	closeAfterStart := []*os.File{}
+	defer func() {
+		for _, f := range closeAfterStart {
+			f.Close()
+		}
+	}()
+	copies := []chan struct{}{}
+	waitCopies := func() {
+		for _, done := range copies {
+			<-done
+		}
+	}
+	output := func(w io.Writer) (*os.File, error) {
+		if f, ok := w.(*os.File); ok {
+			return f, nil
+		}
+		if w == nil {
+			f, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+			if err != nil {
+				return nil, err
+			}
+			closeAfterStart = append(closeAfterStart, f)
+			return f, nil
+		}
+		r, pw, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		closeAfterStart = append(closeAfterStart, pw)
+		done := make(chan struct{})
+		go func() {
+			io.Copy(w, r)
+			r.Close()
+			close(done)
+		}()
+		copies = append(copies, done)
+		return pw, nil
+	}
+	stdin, err := os.Open(os.DevNull)
+	if err != nil {
+		return nil, nil, err
+	}
+	closeAfterStart = append(closeAfterStart, stdin)
+	stdout, err := output(c.Stdout)
+	if err != nil {
+		return nil, nil, err
+	}
+	stderr := stdout
+	if c.Stderr != c.Stdout {
+		if stderr, err = output(c.Stderr); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	p, err := namespace.StartProcess(os.Args[0], []string{os.Args[0]}, &namespace.ProcAttr{
+		Env:        append(os.Environ(), envName+"="+c.Name),
+		Files:      append([]*os.File{stdin, stdout, stderr}, extra...),
+		Executable: exe,
+		Namespaces: c.Namespaces,
+		Unshare:    c.Unshare,
+	})
+	// the copies only finish once the parent's write ends are closed too
+	for _, f := range closeAfterStart {
+		f.Close()
+	}
+	closeAfterStart = nil
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, func() error {
+		st, err := p.Wait()
+		waitCopies()
+		if err != nil {
+			return err
+		}
+		if !st.Success() {
+			return &exec.ExitError{ProcessState: st}
+		}
+		return nil
+	}, nil
+}
+
+// startUnshared starts the process in a new user namespace with namespace.Cmd. It joins Namespaces from Init.
+func (c *Cmd) startUnshared(extra []*os.File) (*os.Process, func() error, error) {
+	for _, ns := range c.Namespaces {
+		if ns.Type() == namespace.USER || ns.Type() == namespace.TIME {
+			return nil, nil, namespace.NewError("reexec", ns.FileName(), ns.Type(), namespace.ErrSingleThreaded)
+		}
+	}
+	files := append([]*os.File{}, extra...)
+	defer func() {
+		for _, f := range files[len(extra):] {
+			f.Close()
+		}
+	}()
+	for _, ns := range c.Namespaces {
+		f, err := ns.File()
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, f)
+	}
+
+	cmd := namespace.Command(nil, "/proc/self/exe")
+	cmd.Args = []string{os.Args[0]}
+	cmd.Env = append(os.Environ(), envName+"="+c.Name, envNsFds+"="+strconv.Itoa(len(c.Namespaces)))
+	if c.Setup != nil {
+		cmd.Env = append(cmd.Env, envExec+"=1")
+	}
+	cmd.ExtraFiles = files
+	cmd.Stdout = c.Stdout
+	cmd.Stderr = c.Stderr
+	cmd.Unshare = c.Unshare
+	cmd.UidMappings = c.UidMappings
+	cmd.GidMappings = c.GidMappings
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	return cmd.Process, cmd.Wait, nil
+}
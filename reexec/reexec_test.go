@@ -0,0 +1,185 @@
+package reexec
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/thegrumpylion/namespace"
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	Register("links", func(arg []byte) ([]byte, error) {
+		out := []string{}
+		for _, name := range strings.Fields(string(arg)) {
+			l, err := os.Readlink("/proc/thread-self/ns/" + name)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, l)
+		}
+		return []byte(strings.Join(out, " ")), nil
+	})
+	Register("fail", func(arg []byte) ([]byte, error) {
+		return nil, errors.New(string(arg))
+	})
+	Register("pid", func(arg []byte) ([]byte, error) {
+		return []byte(strconv.Itoa(os.Getpid())), nil
+	})
+	Register("mount", func(arg []byte) ([]byte, error) {
+		dir, err := ioutil.TempDir("", "reexec")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(dir)
+		if err := unix.Mount("tmpfs", dir, "tmpfs", 0, ""); err != nil {
+			return nil, err
+		}
+		defer unix.Unmount(dir, 0)
+		return []byte(strconv.Itoa(os.Getuid())), nil
+	})
+}
+
+func TestMain(m *testing.M) {
+	Init()
+	os.Exit(m.Run())
+}
+
+func TestRun(t *testing.T) {
+	m := namespace.NewMask().Set(namespace.USER).Set(namespace.NET).Set(namespace.UTS).Set(namespace.MNT)
+
+	c := namespace.Command(nil, "sleep", "7200")
+	c.Unshare = m
+	c.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	c.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+
+	nss := []*namespace.Namespace{}
+	names := []string{}
+	for _, nsType := range m.Types() {
+		ns, err := namespace.FromPID(c.Process.Pid, nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ns.Close()
+		nss = append(nss, ns)
+		names = append(names, nsType.StringLower())
+	}
+
+	out, err := Command("links", []byte(strings.Join(names, " ")), nss...).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lnks := strings.Fields(string(out))
+	for i, ns := range nss {
+		if lnks[i] != ns.ID().String() {
+			t.Fatalf("expecting %s but got %s", ns.ID(), lnks[i])
+		}
+	}
+
+	// mounting needs privilege over the joined mount ns, which only the joined user ns has
+	out, err = Command("mount", nil, nss...).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "0" {
+		t.Fatal("expecting uid 0 in joined user ns but got", string(out))
+	}
+}
+
+func TestRunTime(t *testing.T) {
+	c := namespace.Command(nil, "sleep", "7200")
+	c.Unshare = namespace.NewMask().Set(namespace.TIME)
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+	ns, err := namespace.FromPID(c.Process.Pid, namespace.TIME)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+
+	out, err := Command("links", []byte("time"), ns).Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != ns.ID().String() {
+		t.Fatalf("expecting %s but got %s", ns.ID(), out)
+	}
+}
+
+func TestRunUnsharePID(t *testing.T) {
+	cmd := Command("pid", nil)
+	cmd.Unshare = namespace.NewMask().Set(namespace.PID).Set(namespace.TIME)
+	out, err := cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "1" {
+		t.Fatal("expecting pid 1 in new pid ns but got", string(out))
+	}
+}
+
+func TestRunUnshareJoin(t *testing.T) {
+	usr, err := namespace.Self(namespace.USER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer usr.Close()
+	cmd := Command("links", nil, usr)
+	cmd.Unshare = namespace.NewMask().Set(namespace.USER)
+	if _, err := cmd.Run(); !errors.Is(err, namespace.ErrSingleThreaded) {
+		t.Fatal("expecting ErrSingleThreaded but got", err)
+	}
+}
+
+func TestRunError(t *testing.T) {
+	_, err := Command("fail", []byte("boom")).Run()
+	if err == nil || err.Error() != "boom" {
+		t.Fatal("expecting error boom but got", err)
+	}
+	if _, err := Command("unknown", nil).Run(); err == nil {
+		t.Fatal("expecting error for unregistered function")
+	}
+}
+
+func TestRunUnshareUser(t *testing.T) {
+	setup := false
+	cmd := Command("mount", nil)
+	cmd.Unshare = namespace.NewMask().Set(namespace.USER).Set(namespace.MNT)
+	cmd.Setup = func(pid int) error {
+		setup = true
+		if err := ioutil.WriteFile("/proc/"+strconv.Itoa(pid)+"/setgroups", []byte("deny"), 0); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile("/proc/"+strconv.Itoa(pid)+"/uid_map", []byte("0 "+strconv.Itoa(os.Getuid())+" 1"), 0); err != nil {
+			return err
+		}
+		return ioutil.WriteFile("/proc/"+strconv.Itoa(pid)+"/gid_map", []byte("0 "+strconv.Itoa(os.Getgid())+" 1"), 0)
+	}
+	out, err := cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !setup {
+		t.Fatal("setup was not called")
+	}
+	if string(out) != "0" {
+		t.Fatal("expecting uid 0 in new user ns but got", string(out))
+	}
+}
@@ -0,0 +1,130 @@
+// Package rootless lets an unprivileged user create a user namespace with its subordinate ids mapped through
+// the setuid newuidmap and newgidmap helpers, inside which mounting, the fs store and creating other
+// namespaces are permitted.
+package rootless
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/thegrumpylion/namespace"
+	"github.com/thegrumpylion/namespace/reexec"
+)
+
+// Executor runs the id map helpers. It is pluggable so tests can stub them
+type Executor interface {
+	Run(name string, arg ...string) error
+}
+
+type execExecutor struct{}
+
+func (execExecutor) Run(name string, arg ...string) error {
+	out, err := exec.Command(name, arg...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// DefaultExecutor runs the helpers with os/exec, looking them up in PATH
+var DefaultExecutor Executor = execExecutor{}
+
+// Mappings returns the uid and gid maps for the current user: root in the namespace is the user itself and
+// its subordinate ids follow from 1 on
+func Mappings() (uid namespace.IDMap, gid namespace.IDMap, err error) {
+	u, err := user.Current()
+	if err != nil {
+		return nil, nil, err
+	}
+	if uid, err = mappings(SubUIDPath, u.Username, u.Uid, os.Getuid()); err != nil {
+		return nil, nil, err
+	}
+	if gid, err = mappings(SubGIDPath, u.Username, u.Uid, os.Getgid()); err != nil {
+		return nil, nil, err
+	}
+	return uid, gid, nil
+}
+
+func mappings(path, name, uid string, id int) (namespace.IDMap, error) {
+	subs, err := LookupSubIDs(path, name, uid)
+	if err != nil {
+		return nil, err
+	}
+	m := namespace.IDMap{{ContainerID: 0, HostID: uint32(id), Size: 1}}
+	next := uint32(1)
+	for _, s := range subs {
+		m = append(m, namespace.IDMapping{ContainerID: next, HostID: s.Start, Size: s.Count})
+		next += s.Count
+	}
+	return m, nil
+}
+
+// WriteMappings writes the uid and gid maps of the user namespace of pid with newuidmap and newgidmap run by
+// ex, DefaultExecutor if nil. Either map can be nil to leave it unset.
+func WriteMappings(ex Executor, pid int, uid, gid namespace.IDMap) error {
+	if ex == nil {
+		ex = DefaultExecutor
+	}
+	for _, m := range []struct {
+		helper string
+		m      namespace.IDMap
+	}{{"newuidmap", uid}, {"newgidmap", gid}} {
+		if m.m == nil {
+			continue
+		}
+		if err := m.m.Validate(); err != nil {
+			return err
+		}
+		if err := ex.Run(m.helper, helperArgs(pid, m.m)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// helperArgs returns the arguments of newuidmap and newgidmap for m
+func helperArgs(pid int, m namespace.IDMap) []string {
+	args := []string{strconv.Itoa(pid)}
+	for _, e := range m {
+		args = append(args,
+			strconv.FormatUint(uint64(e.ContainerID), 10),
+			strconv.FormatUint(uint64(e.HostID), 10),
+			strconv.FormatUint(uint64(e.Size), 10))
+	}
+	return args
+}
+
+// Config of a rootless Command
+type Config struct {
+	// Executor runs the helpers, DefaultExecutor if nil
+	Executor Executor
+	// UIDMap and GIDMap of the new user namespace. Mappings if both are nil
+	UIDMap namespace.IDMap
+	GIDMap namespace.IDMap
+	// Unshare has the types of new namespaces created next to the user namespace. A new mount namespace is
+	// always created so mounts don't need the caller's mount namespace
+	Unshare namespace.Mask
+}
+
+// Command returns a reexec.Cmd that runs the function registered as name in a new user and mount namespace,
+// mapped with the helpers before the function runs. Inside it the function has all capabilities, e.g. to
+// create a fs store or other namespaces. reexec.Init has to be called by the program.
+func Command(cfg Config, name string, arg []byte) (*reexec.Cmd, error) {
+	uid, gid := cfg.UIDMap, cfg.GIDMap
+	if uid == nil && gid == nil {
+		var err error
+		if uid, gid, err = Mappings(); err != nil {
+			return nil, err
+		}
+	}
+	c := reexec.Command(name, arg)
+	c.Unshare = cfg.Unshare.Set(namespace.USER).Set(namespace.MNT)
+	c.Setup = func(pid int) error {
+		return WriteMappings(cfg.Executor, pid, uid, gid)
+	}
+	return c, nil
+}
@@ -0,0 +1,157 @@
+package rootless
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/thegrumpylion/namespace"
+	"github.com/thegrumpylion/namespace/reexec"
+	"github.com/thegrumpylion/namespace/store/fs"
+)
+
+func init() {
+	reexec.Register("store", func(arg []byte) ([]byte, error) {
+		st, err := fs.NewFsStore(string(arg), fs.FsTmpfs, false)
+		if err != nil {
+			return nil, err
+		}
+		nss, err := namespace.Unshare(namespace.NewMask().Set(namespace.NET).Set(namespace.UTS))
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range nss {
+			if err := st.Add(ns, "rootless"); err != nil {
+				return nil, err
+			}
+			stored, err := st.Get(ns.Type(), "rootless")
+			if err != nil {
+				return nil, err
+			}
+			if !stored.Equal(ns) {
+				return nil, errors.New("stored " + stored.ID().String() + " instead of " + ns.ID().String())
+			}
+			stored.Close()
+			ns.Close()
+		}
+		return []byte(strconv.Itoa(os.Getuid()) + " " + strings.Join(st.List(namespace.NET), ",")), nil
+	})
+}
+
+func TestMain(m *testing.M) {
+	reexec.Init()
+	os.Exit(m.Run())
+}
+
+// stubExecutor writes the maps directly instead of running the helpers. Without privilege in the parent ns only
+// a single mapping of the caller's own id can be written
+type stubExecutor struct {
+	calls []string
+}
+
+func (s *stubExecutor) Run(name string, arg ...string) error {
+	s.calls = append(s.calls, name+" "+strings.Join(arg, " "))
+	pid, err := strconv.Atoi(arg[0])
+	if err != nil {
+		return err
+	}
+	// the helpers take the mappings as triplets of arguments
+	lines := []string{}
+	for i := 1; i+2 < len(arg); i += 3 {
+		lines = append(lines, strings.Join(arg[i:i+3], " "))
+	}
+	m, err := namespace.ParseIDMap(strings.Join(lines, "\n"))
+	if err != nil {
+		return err
+	}
+	switch name {
+	case "newuidmap":
+		return namespace.WriteIDMaps(pid, m, nil)
+	case "newgidmap":
+		// unlike the setuid helper an unprivileged caller can only write the gid map with setgroups denied
+		if err := namespace.WriteSetgroups(pid, false); err != nil {
+			return err
+		}
+		return namespace.WriteIDMaps(pid, nil, m)
+	}
+	return errors.New("unknown helper " + name)
+}
+
+func runStore(t *testing.T, ex Executor, uid, gid namespace.IDMap) {
+	dir, err := ioutil.TempDir("", "rootless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := Command(Config{
+		Executor: ex,
+		UIDMap:   uid,
+		GIDMap:   gid,
+	}, "store", []byte(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := c.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "0 rootless" {
+		t.Fatal("expecting root with a stored net ns but got", string(out))
+	}
+}
+
+func TestCommand(t *testing.T) {
+	ex := &stubExecutor{}
+	uid := namespace.IDMap{{ContainerID: 0, HostID: uint32(os.Getuid()), Size: 1}}
+	gid := namespace.IDMap{{ContainerID: 0, HostID: uint32(os.Getgid()), Size: 1}}
+	runStore(t, ex, uid, gid)
+	if len(ex.calls) != 2 || !strings.HasPrefix(ex.calls[0], "newuidmap ") || !strings.HasSuffix(ex.calls[0], " 0 "+strconv.Itoa(os.Getuid())+" 1") {
+		t.Fatalf("unexpected helper calls %q", ex.calls)
+	}
+}
+
+func TestCommandRanges(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("writing several ranges without the helpers needs root")
+	}
+	ex := &stubExecutor{}
+	uid := namespace.IDMap{{ContainerID: 0, HostID: uint32(os.Getuid()), Size: 1}, {ContainerID: 1, HostID: 100000, Size: 65536}}
+	gid := namespace.IDMap{{ContainerID: 0, HostID: uint32(os.Getgid()), Size: 1}}
+	runStore(t, ex, uid, gid)
+	if len(ex.calls) != 2 || !strings.HasPrefix(ex.calls[0], "newuidmap ") || !strings.HasSuffix(ex.calls[0], " 0 "+strconv.Itoa(os.Getuid())+" 1 1 100000 65536") {
+		t.Fatalf("unexpected helper calls %q", ex.calls)
+	}
+}
+
+func TestCommandHelpers(t *testing.T) {
+	if _, err := exec.LookPath("newuidmap"); err != nil {
+		t.Skip("newuidmap not installed")
+	}
+	if _, err := exec.LookPath("newgidmap"); err != nil {
+		t.Skip("newgidmap not installed")
+	}
+	uid, gid, err := Mappings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uid) < 2 || len(gid) < 2 {
+		t.Skip("no subordinate ids for the current user")
+	}
+	dir, err := ioutil.TempDir("", "rootless")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c, err := Command(Config{}, "store", []byte(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Run(); err != nil {
+		t.Fatal(err)
+	}
+}
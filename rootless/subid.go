@@ -0,0 +1,84 @@
+package rootless
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// SubUIDPath and SubGIDPath are the files subordinate ids are read from
+var (
+	SubUIDPath = "/etc/subuid"
+	SubGIDPath = "/etc/subgid"
+)
+
+// SubID is a range of subordinate ids delegated to a user, a line of /etc/subuid or /etc/subgid
+type SubID struct {
+	// Name is the user name or uid the range belongs to
+	Name  string
+	Start uint32
+	Count uint32
+}
+
+// ParseSubIDs returns the entries in the format of /etc/subuid and /etc/subgid, name:start:count per line.
+// Empty lines and comments are skipped.
+func ParseSubIDs(r io.Reader) ([]SubID, error) {
+	out := []SubID{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Split(line, ":")
+		if len(f) != 3 || f[0] == "" {
+			return nil, fmt.Errorf("malformed subordinate id line %q", line)
+		}
+		start, err := strconv.ParseUint(f[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed subordinate id line %q", line)
+		}
+		count, err := strconv.ParseUint(f[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed subordinate id line %q", line)
+		}
+		out = append(out, SubID{
+			Name:  f[0],
+			Start: uint32(start),
+			Count: uint32(count),
+		})
+	}
+	return out, sc.Err()
+}
+
+// ReadSubIDs returns the entries of the file at path
+func ReadSubIDs(path string) ([]SubID, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseSubIDs(f)
+}
+
+// LookupSubIDs returns the entries of the file at path for the user with name or uid. A missing file has no
+// entries.
+func LookupSubIDs(path, name, uid string) ([]SubID, error) {
+	all, err := ReadSubIDs(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := []SubID{}
+	for _, s := range all {
+		if s.Count > 0 && (s.Name == name || s.Name == uid) {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,55 @@
+package rootless
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSubIDs(t *testing.T) {
+	subs, err := ParseSubIDs(strings.NewReader("# comment\nalice:100000:65536\n\n1001:165536:65536\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SubID{{"alice", 100000, 65536}, {"1001", 165536, 65536}}
+	if len(subs) != len(want) || subs[0] != want[0] || subs[1] != want[1] {
+		t.Fatalf("expecting %v but got %v", want, subs)
+	}
+	for _, bad := range []string{"alice:100000", ":1:1", "alice:x:1", "alice:1:-1"} {
+		if _, err := ParseSubIDs(strings.NewReader(bad)); err == nil {
+			t.Errorf("expecting error for %q", bad)
+		}
+	}
+}
+
+func TestLookupSubIDs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "subid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "subuid")
+	if err := ioutil.WriteFile(path, []byte("alice:100000:65536\nbob:165536:65536\n1000:231072:1000\nalice:300000:0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	subs, err := LookupSubIDs(path, "alice", "1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 2 || subs[0].Start != 100000 || subs[1].Start != 231072 {
+		t.Fatalf("unexpected entries %v", subs)
+	}
+	if subs, err := LookupSubIDs(filepath.Join(dir, "nope"), "alice", "1000"); err != nil || len(subs) != 0 {
+		t.Fatal("expecting no entries for missing file but got", subs, err)
+	}
+
+	m, err := mappings(path, "bob", "1001", 1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.String() != "0 1001 1\n1 165536 65536\n" {
+		t.Fatalf("unexpected mappings %q", m.String())
+	}
+}
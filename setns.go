@@ -0,0 +1,137 @@
+package namespace
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// PidFD is an open pidfd for a process. It can be used to enter several of the process namespaces at once
+type PidFD struct {
+	pid  int
+	file *os.File
+}
+
+// OpenPidFD returns a new pidfd for pid. Needs linux 5.3 or later
+func OpenPidFD(pid int) (*PidFD, error) {
+	fd, _, e := unix.Syscall(unix.SYS_PIDFD_OPEN, uintptr(pid), 0, 0)
+	if e != 0 {
+		return nil, NewError("pidfd_open", "", INVALID, e)
+	}
+	return &PidFD{
+		pid:  pid,
+		file: os.NewFile(fd, "pidfd:"+strconv.Itoa(pid)),
+	}, nil
+}
+
+// Pid returns the pid the pidfd refers to
+func (p *PidFD) Pid() int {
+	return p.pid
+}
+
+// Fd returns the number of the file descriptor
+func (p *PidFD) Fd() int {
+	return int(p.file.Fd())
+}
+
+// Close the pidfd
+func (p *PidFD) Close() error {
+	return p.file.Close()
+}
+
+// Set the callers namespaces of the types in m to the ones of the process. On linux 5.8 or later all of
+// them are entered atomically, on older kernels each one is entered from procfs in turn and a failure
+// can leave the caller in some of them. Like Namespace.Set it only affects the calling thread, which has to
+// be locked with runtime.LockOSThread and, with MNT in m, never unlocked again: the thread unshares its
+// filesystem attributes, which are otherwise shared by every thread of the process, before entering the
+// mount namespace. Do and DoProcess take care of this.
+func (p *PidFD) Set(m Mask) error {
+	if err := unshareFS(m); err != nil {
+		return err
+	}
+	if !pidfdSetnsSupported() {
+		return setSequential(p.pid, m)
+	}
+	if err := unix.Setns(p.Fd(), int(m)); err != nil {
+		return NewError("setns", p.file.Name(), INVALID, err)
+	}
+	return nil
+}
+
+// SetFromProcess sets the callers namespaces of the types in m to the ones of process pid. See PidFD.Set
+func SetFromProcess(pid int, m Mask) error {
+	p, err := OpenPidFD(pid)
+	if errors.Is(err, unix.ENOSYS) {
+		if err := unshareFS(m); err != nil {
+			return err
+		}
+		return setSequential(pid, m)
+	}
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+	return p.Set(m)
+}
+
+// unshareFS unshares the filesystem attributes of the calling thread if m has MNT. Entering a mount namespace
+// sets the root and working directory, for every thread that shares them.
+func unshareFS(m Mask) error {
+	if !m.Has(MNT) {
+		return nil
+	}
+	if err := unix.Unshare(unix.CLONE_FS); err != nil {
+		return NewError("unshare", "", MNT, err)
+	}
+	return nil
+}
+
+var (
+	pidfdSetnsOnce sync.Once
+	pidfdSetns     bool
+)
+
+// pidfdSetnsSupported is true if setns accepts a pidfd, linux 5.8 or later. Older kernels fail with EINVAL
+// for a file that is not a namespace. The probe enters the uts namespace of the process on a thread that is
+// discarded afterwards.
+func pidfdSetnsSupported() bool {
+	pidfdSetnsOnce.Do(func() {
+		p, err := OpenPidFD(os.Getpid())
+		if err != nil {
+			return
+		}
+		defer p.Close()
+		onLockedThread(func() bool {
+			pidfdSetns = unix.Setns(p.Fd(), unix.CLONE_NEWUTS) != unix.EINVAL
+			return false
+		})
+	})
+	return pidfdSetns
+}
+
+// setSequential enters each namespace of pid in m in setnsOrder. All files are opened upfront so
+// entering the mount namespace doesn't change what procfs we look at.
+func setSequential(pid int, m Mask) error {
+	nss := []*Namespace{}
+	defer func() {
+		for _, ns := range nss {
+			ns.Close()
+		}
+	}()
+	for _, t := range m.Types() {
+		ns, err := FromPID(pid, t)
+		if err != nil {
+			return err
+		}
+		nss = append(nss, ns)
+	}
+	for _, ns := range nss {
+		if err := ns.Set(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package namespace
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func testSetFromProcess(t *testing.T, set func(pid int, m Mask) error) {
+	m := NewMask().Set(NET).Set(UTS).Set(IPC)
+
+	c, err := newProcess(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+
+	ppid := c.Process.Pid
+
+	errc := make(chan error, 1)
+	onLockedThread(func() bool {
+		errc <- func() error {
+			if err := set(ppid, m); err != nil {
+				return err
+			}
+			for _, nsType := range m.Types() {
+				trgt, err := FromPID(ppid, nsType)
+				if err != nil {
+					return err
+				}
+				defer trgt.Close()
+				cur, err := ThreadSelf(nsType)
+				if err != nil {
+					return err
+				}
+				defer cur.Close()
+				if cur.Ino() != trgt.Ino() {
+					t.Errorf("thread not in %s ns of %d", nsType, ppid)
+				}
+			}
+			return nil
+		}()
+		return false
+	})
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSetFromProcess(t *testing.T) {
+	testSetFromProcess(t, SetFromProcess)
+}
+
+func TestSetSequential(t *testing.T) {
+	testSetFromProcess(t, setSequential)
+}
+
+func TestSetFromProcessMount(t *testing.T) {
+	m := NewMask().Set(NET).Set(MNT)
+
+	c, err := newProcess(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	errc := make(chan error, 1)
+	onLockedThread(func() bool {
+		errc <- SetFromProcess(c.Process.Pid, m)
+		return false
+	})
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	// the other threads keep their root and working directory
+	if cur, err := os.Getwd(); err != nil || cur != dir {
+		t.Fatalf("expecting working directory %s but got %s %v", dir, cur, err)
+	}
+
+	// an invalid request is not mistaken for a kernel without pidfd support
+	onLockedThread(func() bool {
+		errc <- SetFromProcess(c.Process.Pid, Mask(unix.CLONE_VM))
+		return false
+	})
+	if err := <-errc; !errors.Is(err, unix.EINVAL) {
+		t.Fatal("expecting EINVAL but got", err)
+	}
+}
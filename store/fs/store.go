@@ -1,11 +1,11 @@
 package fs
 
 import (
-	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 
 	"github.com/thegrumpylion/namespace"
@@ -37,28 +37,28 @@ func NewFsStore(root string, ft FsType, flat bool) (store.Store, error) {
 	switch ft {
 	case FsTmpfs:
 		if err := unix.Mount("tmpfs", root, "tmpfs", 0, ""); err != nil {
-			return nil, fmt.Errorf("tmpfs mount %s fail: %v", root, err)
+			return nil, namespace.NewError("mount tmpfs", root, namespace.INVALID, err)
 		}
 		if err := unix.Mount("tmpfs", root, "tmpfs", unix.MS_PRIVATE, ""); err != nil {
-			return nil, fmt.Errorf("tmpfs make private %s fail: %v", root, err)
+			return nil, namespace.NewError("make private tmpfs", root, namespace.INVALID, err)
 		}
 	case FsBind:
 		if err := unix.Mount(root, root, "", unix.MS_BIND, ""); err != nil {
-			return nil, fmt.Errorf("bind mount %s fail: %v", root, err)
+			return nil, namespace.NewError("mount bind", root, namespace.INVALID, err)
 		}
 		if err := unix.Mount("", root, "", unix.MS_PRIVATE, ""); err != nil {
-			return nil, fmt.Errorf("bind mount make private %s fail: %v", root, err)
+			return nil, namespace.NewError("make private bind", root, namespace.INVALID, err)
 		}
 	}
 	empty, err := dirIsEmpty(root)
 	if err != nil {
-		return nil, err
+		return nil, namespace.NewError("open", root, namespace.INVALID, err)
 	}
 	if empty && !flat {
 		for _, t := range namespace.Types() {
 			err := os.Mkdir(filepath.Join(root, t.StringLower()), 0666)
 			if err != nil {
-				return nil, err
+				return nil, namespace.NewError("mkdir", "", t, err)
 			}
 		}
 	}
@@ -70,37 +70,56 @@ func NewFsStore(root string, ft FsType, flat bool) (store.Store, error) {
 
 // Add bind mounts the namespace in the fs store
 func (s *fsStore) Add(ns *namespace.Namespace, name string) error {
-	if _, err := os.Stat(ns.FileName()); err != nil {
-		return err
-	}
-	src := ns.FileName()
-
 	trgt := s.targetPath(name, ns.Type())
 
 	if _, err := os.Stat(trgt); err == nil {
-		return store.ErrExists
+		return namespace.NewError("add", trgt, ns.Type(), store.ErrExists)
+	}
+
+	var err error
+	cerr := ns.Control(func(fd uintptr) {
+		err = bind(fd, trgt, ns)
+	})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// bind bind mounts the open file fd of ns on trgt. The name of ns may refer to another namespace by now e.g.
+// for thread-self
+func bind(fd uintptr, trgt string, ns *namespace.Namespace) error {
+	src := filepath.Join(namespace.PROCFSPath, "self", "fd", strconv.Itoa(int(fd)))
+	if _, err := os.Stat(src); err != nil {
+		return namespace.NewError("add", ns.FileName(), ns.Type(), err)
 	}
 
 	f, err := os.Create(trgt)
 	if err != nil {
-		return err
+		return namespace.NewError("add", "", ns.Type(), err)
 	}
 	defer f.Close()
 
-	return unix.Mount(src, trgt, "", unix.MS_BIND, "")
+	if err := unix.Mount(src, trgt, "", unix.MS_BIND, ""); err != nil {
+		return namespace.NewError("add", trgt, ns.Type(), err)
+	}
+	return nil
 }
 
 // Delete closse the namespace file and removes it from store
 func (s *fsStore) Delete(typ namespace.Type, name string) error {
+	trgt := s.targetPath(name, typ)
 	if !s.Exists(typ, name) {
-		return store.ErrNotExists
+		return namespace.NewError("delete", trgt, typ, store.ErrNotExists)
 	}
-	trgt := s.targetPath(name, typ)
 	err := unix.Unmount(trgt, 0)
 	if err != nil {
-		return err
+		return namespace.NewError("delete", trgt, typ, err)
 	}
-	return os.Remove(trgt)
+	if err := os.Remove(trgt); err != nil {
+		return namespace.NewError("delete", "", typ, err)
+	}
+	return nil
 }
 
 // Exists checks if a namespace with given type and name exists in the store
@@ -114,10 +133,10 @@ func (s *fsStore) Exists(typ namespace.Type, name string) bool {
 
 // Get dups and returns the namespace with given type and name from store
 func (s *fsStore) Get(typ namespace.Type, name string) (*namespace.Namespace, error) {
+	trgt := s.targetPath(name, typ)
 	if !s.Exists(typ, name) {
-		return nil, store.ErrNotExists
+		return nil, namespace.NewError("get", trgt, typ, store.ErrNotExists)
 	}
-	trgt := s.targetPath(name, typ)
 	return namespace.FromPath(trgt)
 }
 
@@ -26,13 +26,13 @@ func NewMemStore() store.Store {
 
 // Add dups and saves the namespace in the store
 func (s *memStore) Add(ns *namespace.Namespace, name string) error {
+	if _, ok := s.data[ns.Type()][name]; ok {
+		return namespace.NewError("add", name, ns.Type(), store.ErrExists)
+	}
 	newNs, err := ns.Dup()
 	if err != nil {
 		return err
 	}
-	if _, ok := s.data[ns.Type()][name]; ok {
-		return store.ErrExists
-	}
 	s.data[ns.Type()][name] = newNs
 	return nil
 }
@@ -40,7 +40,7 @@ func (s *memStore) Add(ns *namespace.Namespace, name string) error {
 // Delete closse the namespace file and removes it from store
 func (s *memStore) Delete(typ namespace.Type, name string) error {
 	if _, ok := s.data[typ][name]; !ok {
-		return store.ErrNotExists
+		return namespace.NewError("delete", name, typ, store.ErrNotExists)
 	}
 	// keep a ref to the ns
 	ns := s.data[typ][name]
@@ -64,7 +64,7 @@ func (s *memStore) Get(typ namespace.Type, name string) (*namespace.Namespace, e
 		}
 		return newNs, nil
 	}
-	return nil, store.ErrNotExists
+	return nil, namespace.NewError("get", name, typ, store.ErrNotExists)
 }
 
 // List returns the names of saved namespaces for the given type
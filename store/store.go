@@ -20,8 +20,8 @@ type Store interface {
 	List(typ namespace.Type) []string
 }
 
-// ErrExists is returned when trying to add new namespace with existing name
+// ErrExists is returned wrapped in a *namespace.NamespaceError when trying to add new namespace with existing name
 var ErrExists = errors.New("namespace already in store")
 
-// ErrNotExists is returned when trying to get a namespace with unknown name
+// ErrNotExists is returned wrapped in a *namespace.NamespaceError when trying to get a namespace with unknown name
 var ErrNotExists = errors.New("namespace not in store")
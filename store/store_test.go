@@ -1,6 +1,8 @@
 package store_test
 
 import (
+	"errors"
+	"net"
 	"os/exec"
 	"syscall"
 	"testing"
@@ -15,7 +17,7 @@ import (
 func newProcess(m namespace.Mask) (*exec.Cmd, error) {
 	c := exec.Command("sleep", "7200")
 	c.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: m.Uintptr(),
+		Cloneflags: m.CloneFlags(),
 	}
 	if err := c.Start(); err != nil {
 		return nil, err
@@ -45,6 +47,17 @@ func testStore(t *testing.T, s store.Store, pfx string) {
 			t.Fatalf("fail to get %s ns for pid %d", nsType, ppid)
 		}
 		s.Add(ns, nsname(nsType))
+		if err := s.Add(ns, nsname(nsType)); !errors.Is(err, store.ErrExists) {
+			t.Fatal("expecting ErrExists but got", err)
+		}
+	}
+
+	if _, err := s.Get(namespace.NET, "nonexistent"); !errors.Is(err, store.ErrNotExists) {
+		t.Fatal("expecting ErrNotExists but got", err)
+	}
+	var nsErr *namespace.NamespaceError
+	if err := s.Delete(namespace.NET, "nonexistent"); !errors.As(err, &nsErr) || nsErr.Type != namespace.NET {
+		t.Fatal("expecting *namespace.NamespaceError for net but got", err)
 	}
 
 	for _, nsType := range namespace.Types() {
@@ -79,6 +92,86 @@ func testStore(t *testing.T, s store.Store, pfx string) {
 
 }
 
+// testStoreUnshared checks that namespaces from Unshare, which are opened through thread-self, are stored
+// and not the namespaces of the thread calling Add
+func testStoreUnshared(t *testing.T, s store.Store, pfx string) {
+	nss, err := namespace.Unshare(namespace.NewMask().Set(namespace.NET).Set(namespace.UTS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for nsType, ns := range nss {
+		defer ns.Close()
+		if err := s.Add(ns, pfx+"unshared"); err != nil {
+			t.Fatal(err)
+		}
+		defer s.Delete(nsType, pfx+"unshared")
+		stored, err := s.Get(nsType, pfx+"unshared")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stored.Close()
+		if !stored.Equal(ns) {
+			t.Fatalf("expecting %s in store but got %s", ns.ID(), stored.ID())
+		}
+	}
+	closed, err := namespace.Self(namespace.NET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+	if err := s.Add(closed, pfx+"closed"); !errors.Is(err, namespace.ErrClosed) {
+		t.Fatal("expecting ErrClosed but got", err)
+	}
+	if s.Exists(namespace.NET, pfx+"closed") {
+		t.Fatal("expecting closed namespace not to be stored")
+	}
+}
+
+// testStoreNetNS checks that a namespace from NewNetNS is stored ready to use, with its loopback up and
+// sysctls set, after the original is closed
+func testStoreNetNS(t *testing.T, s store.Store, pfx string) {
+	ns, err := namespace.NewNetNS(namespace.NetNSOptions{
+		Sysctls: map[string]string{
+			"net.ipv4.ip_forward": "1",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := ns.ID()
+	err = s.Add(ns, pfx+"netns")
+	ns.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Delete(namespace.NET, pfx+"netns")
+
+	stored, err := s.Get(namespace.NET, pfx+"netns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stored.Close()
+	if !stored.ID().Equal(id) {
+		t.Fatalf("expecting %s in store but got %s", id, stored.ID())
+	}
+	if v, err := namespace.ReadSysctl(stored, "net.ipv4.ip_forward"); err != nil || v != "1" {
+		t.Fatal("expecting ip_forward 1 but got", v, err)
+	}
+	err = stored.Do(func() error {
+		lo, err := net.InterfaceByName("lo")
+		if err != nil {
+			return err
+		}
+		if lo.Flags&net.FlagUp == 0 {
+			return errors.New("lo is down")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestFsStoreTmpfs(t *testing.T) {
 	tmp := t.TempDir()
 
@@ -89,6 +182,8 @@ func TestFsStoreTmpfs(t *testing.T) {
 	defer unix.Unmount(tmp, 0)
 
 	testStore(t, s, "tmpfs_")
+	testStoreUnshared(t, s, "tmpfs_")
+	testStoreNetNS(t, s, "tmpfs_")
 }
 
 func TestFsStoreBind(t *testing.T) {
@@ -101,6 +196,8 @@ func TestFsStoreBind(t *testing.T) {
 	defer unix.Unmount(tmp, 0)
 
 	testStore(t, s, "bind_")
+	testStoreUnshared(t, s, "bind_")
+	testStoreNetNS(t, s, "bind_")
 }
 
 func TestMemStore(t *testing.T) {
@@ -108,4 +205,6 @@ func TestMemStore(t *testing.T) {
 	s := mem.NewMemStore()
 
 	testStore(t, s, "mem_")
+	testStoreUnshared(t, s, "mem_")
+	testStoreNetNS(t, s, "mem_")
 }
@@ -0,0 +1,192 @@
+package namespace
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrSysctlType returned when a sysctl is not governed by the type of the namespace it is read or written in
+var ErrSysctlType = errors.New("sysctl not governed by ns type")
+
+// ErrSysctlCallerOnly returned for sysctls of user and pid namespaces other than the caller's. Those depend
+// on the namespaces of the process, which can't be changed by entering them from a thread
+var ErrSysctlCallerOnly = errors.New("sysctl only accessible from the caller's ns")
+
+// ipcSysctls are the kernel.* sysctls of an ipc namespace
+var ipcSysctls = []string{
+	"kernel.auto_msgmni",
+	"kernel.msg_next_id",
+	"kernel.msgmax",
+	"kernel.msgmnb",
+	"kernel.msgmni",
+	"kernel.sem",
+	"kernel.sem_next_id",
+	"kernel.shm_next_id",
+	"kernel.shm_rmid_forced",
+	"kernel.shmall",
+	"kernel.shmmax",
+	"kernel.shmmni",
+}
+
+// sysctlRoots are the keys and subtrees of every namespace type that has sysctls
+var sysctlRoots = map[Type][]string{
+	NET:  {"net"},
+	UTS:  {"kernel.domainname", "kernel.hostname", "kernel.osrelease", "kernel.ostype", "kernel.version"},
+	IPC:  append([]string{"fs.mqueue"}, ipcSysctls...),
+	USER: {"user"},
+	PID:  {"kernel.ns_last_pid"},
+}
+
+// SysctlType returns the type of namespace that governs key, in dotted or slash form e.g. net.ipv4.ip_forward
+// or net/ipv4/ip_forward. INVALID if key is global.
+func SysctlType(key string) Type {
+	key = normalizeSysctl(key)
+	for _, t := range setnsOrder {
+		for _, r := range sysctlRoots[t] {
+			if key == r || strings.HasPrefix(key, r+".") {
+				return t
+			}
+		}
+	}
+	return INVALID
+}
+
+// normalizeSysctl returns key in dotted form. As with sysctl(8) a key is in slash form if its first separator
+// is a slash, and dots in one form are slashes in the other e.g. net/ipv4/conf/eth0.100/forwarding is
+// net.ipv4.conf.eth0/100.forwarding
+func normalizeSysctl(key string) string {
+	key = strings.TrimPrefix(key, "/")
+	if i := strings.IndexAny(key, "./"); i < 0 || key[i] == '.' {
+		return key
+	}
+	return swapSeparators(key)
+}
+
+func swapSeparators(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.':
+			return '/'
+		case '/':
+			return '.'
+		}
+		return r
+	}, key)
+}
+
+// sysctlPath returns the /proc/sys file of key in either form
+func sysctlPath(key string) string {
+	return filepath.Join(PROCFSPath, "sys", swapSeparators(normalizeSysctl(key)))
+}
+
+// ReadSysctl returns the value of key in ns with the trailing newline removed. key has to be governed by the
+// type of ns, see SysctlType.
+func ReadSysctl(ns *Namespace, key string) (string, error) {
+	var val string
+	err := ns.sysctl(key, func(path string) error {
+		b, err := ioutil.ReadFile(path)
+		val = strings.TrimSuffix(string(b), "\n")
+		return err
+	})
+	return val, err
+}
+
+// WriteSysctl sets key to val in ns. key has to be governed by the type of ns, see SysctlType.
+func WriteSysctl(ns *Namespace, key, val string) error {
+	return ns.sysctl(key, func(path string) error {
+		return writeFile(path, val)
+	})
+}
+
+// SnapshotSysctls returns the values of every sysctl governed by the types of nss, read inside the namespace of
+// that type, keyed in dotted form. Sysctls that can't be read, e.g. write only ones, are left out.
+func SnapshotSysctls(nss ...*Namespace) (map[string]string, error) {
+	out := map[string]string{}
+	for _, ns := range nss {
+		if len(sysctlRoots[ns.typ]) == 0 {
+			continue
+		}
+		err := ns.sysctl("", func(string) error {
+			for _, r := range sysctlRoots[ns.typ] {
+				if err := readSysctlTree(sysctlPath(r), out); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func writeFile(path, val string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(val)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// readSysctlTree reads the sysctl file at path or every one below it into out
+func readSysctlTree(path string, out map[string]string) error {
+	root := filepath.Join(PROCFSPath, "sys")
+	return filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			// write only or not readable by the caller
+			return nil
+		}
+		rel, _ := filepath.Rel(root, p)
+		out[normalizeSysctl(rel)] = strings.TrimSuffix(string(b), "\n")
+		return nil
+	})
+}
+
+// sysctl checks that key, if set, is governed by the type of ns and calls fn with its path from inside ns
+func (ns *Namespace) sysctl(key string, fn func(path string) error) error {
+	path := sysctlPath(key)
+	if key != "" && SysctlType(key) != ns.typ {
+		return NewError("sysctl", path, ns.typ, ErrSysctlType)
+	}
+	if ns.typ == USER || ns.typ == PID {
+		self, err := Self(ns.typ)
+		if err != nil {
+			return err
+		}
+		defer self.Close()
+		if !self.Equal(ns) {
+			return NewError("sysctl", path, ns.typ, ErrSysctlCallerOnly)
+		}
+		if err := fn(path); err != nil {
+			return NewError("sysctl", path, ns.typ, err)
+		}
+		return nil
+	}
+	// /proc/sys files are opened from the thread inside ns to get its values
+	err := ns.Do(func() error {
+		return fn(path)
+	})
+	var derr *DoError
+	if errors.As(err, &derr) && derr.Step == StepRun {
+		return NewError("sysctl", path, ns.typ, derr.Err)
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+package namespace
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestSysctlType(t *testing.T) {
+	for key, typ := range map[string]Type{
+		"net.ipv4.ip_forward":                NET,
+		"net/ipv4/conf/eth0.100/forwarding":  NET,
+		"kernel.hostname":                    UTS,
+		"kernel/domainname":                  UTS,
+		"kernel.ostype":                      UTS,
+		"kernel.osrelease":                   UTS,
+		"kernel/version":                     UTS,
+		"kernel.shmmax":                      IPC,
+		"fs.mqueue.msg_max":                  IPC,
+		"user.max_user_namespaces":           USER,
+		"kernel.ns_last_pid":                 PID,
+		"kernel.pid_max":                     INVALID,
+		"kernel.hostnamefoo":                 INVALID,
+		"vm.swappiness":                      INVALID,
+		"net.ipv4.conf.eth0/100.forwarding":  NET,
+		"/net/ipv4/conf/eth0.100/forwarding": NET,
+	} {
+		if got := SysctlType(key); got != typ {
+			t.Errorf("expecting %s for %s but got %s", typ, key, got)
+		}
+	}
+	if p := sysctlPath("net.ipv4.conf.eth0/100.forwarding"); p != "/proc/sys/net/ipv4/conf/eth0.100/forwarding" {
+		t.Error("unexpected path", p)
+	}
+	if p := sysctlPath("net/ipv4/conf/eth0.100/forwarding"); p != "/proc/sys/net/ipv4/conf/eth0.100/forwarding" {
+		t.Error("unexpected path", p)
+	}
+}
+
+func TestSysctl(t *testing.T) {
+	ns, err := NewNetNS(NetNSOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+	self, err := Self(NET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer self.Close()
+
+	orig, err := ReadSysctl(self, "net.ipv4.ip_forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "1"
+	if orig == "1" {
+		want = "0"
+	}
+	if err := WriteSysctl(ns, "net/ipv4/ip_forward", want); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := ReadSysctl(ns, "net.ipv4.ip_forward"); err != nil || v != want {
+		t.Fatalf("expecting %s in ns but got %q %v", want, v, err)
+	}
+	if v, err := ReadSysctl(self, "net.ipv4.ip_forward"); err != nil || v != orig {
+		t.Fatalf("expecting %s in our ns but got %q %v", orig, v, err)
+	}
+
+	if _, err := ReadSysctl(ns, "kernel.hostname"); !errors.Is(err, ErrSysctlType) {
+		t.Fatal("expecting ErrSysctlType but got", err)
+	}
+
+	snap, err := SnapshotSysctls(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap["net.ipv4.ip_forward"] != want {
+		t.Fatalf("expecting %s in snapshot but got %q", want, snap["net.ipv4.ip_forward"])
+	}
+	for k := range snap {
+		if SysctlType(k) != NET {
+			t.Fatal("unexpected key in snapshot", k)
+		}
+	}
+}
+
+func TestSysctlUTS(t *testing.T) {
+	c, err := newProcess(NewMask().Set(UTS).Set(IPC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+	uts, err := FromPID(c.Process.Pid, UTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer uts.Close()
+	ipc, err := FromPID(c.Process.Pid, IPC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ipc.Close()
+
+	if err := WriteSysctl(uts, "kernel.hostname", "sysctl-test"); err != nil {
+		t.Fatal(err)
+	}
+	host, _ := os.Hostname()
+	if host == "sysctl-test" {
+		t.Fatal("expecting our hostname to be unchanged")
+	}
+	if err := WriteSysctl(ipc, "kernel.shmmni", "1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := SnapshotSysctls(uts, ipc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap["kernel.hostname"] != "sysctl-test" || snap["kernel.ostype"] != "Linux" || snap["kernel.shmmni"] != "1234" {
+		t.Fatalf("unexpected snapshot %v", snap)
+	}
+
+	usr, err := FromPID(c.Process.Pid, USER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer usr.Close()
+	if _, err := ReadSysctl(usr, "user.max_user_namespaces"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSysctlCallerOnly(t *testing.T) {
+	c, err := newProcess(NewMask().Set(USER))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+	usr, err := FromPID(c.Process.Pid, USER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer usr.Close()
+	if _, err := ReadSysctl(usr, "user.max_user_namespaces"); !errors.Is(err, ErrSysctlCallerOnly) {
+		t.Fatal("expecting ErrSysctlCallerOnly but got", err)
+	}
+}
@@ -0,0 +1,82 @@
+package namespace
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// TimeOffsets are the clock offsets of a time namespace
+type TimeOffsets struct {
+	Monotonic time.Duration
+	Boottime  time.Duration
+}
+
+// ReadTimeOffsets returns the clock offsets of the time namespace pid's children are created in. Needs procfs.
+func ReadTimeOffsets(pid int) (TimeOffsets, error) {
+	off := TimeOffsets{}
+	b, err := ioutil.ReadFile(timensOffsetsPath(pid))
+	if err != nil {
+		return off, err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) != 3 {
+			return off, fmt.Errorf("malformed timens_offsets line %q", sc.Text())
+		}
+		sec, err := strconv.ParseInt(f[1], 10, 64)
+		if err != nil {
+			return off, err
+		}
+		nsec, err := strconv.ParseInt(f[2], 10, 64)
+		if err != nil {
+			return off, err
+		}
+		d := time.Duration(sec)*time.Second + time.Duration(nsec)
+		switch f[0] {
+		case "monotonic", strconv.Itoa(unix.CLOCK_MONOTONIC):
+			off.Monotonic = d
+		case "boottime", strconv.Itoa(unix.CLOCK_BOOTTIME):
+			off.Boottime = d
+		}
+	}
+	return off, sc.Err()
+}
+
+// WriteTimeOffsets sets the clock offsets of the time namespace pid's children will be created in. The kernel
+// only accepts offsets for a newly unshared time namespace that no process has entered yet. Needs procfs.
+func WriteTimeOffsets(pid int, off TimeOffsets) error {
+	f, err := os.OpenFile(timensOffsetsPath(pid), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// both clocks go in a single write so the kernel applies them together
+	_, err = f.WriteString(formatTimeOffset(unix.CLOCK_MONOTONIC, off.Monotonic) +
+		formatTimeOffset(unix.CLOCK_BOOTTIME, off.Boottime))
+	return err
+}
+
+func formatTimeOffset(clock int, d time.Duration) string {
+	sec := int64(d / time.Second)
+	nsec := int64(d % time.Second)
+	// nanoseconds must be in [0, 1e9) so negative offsets borrow from seconds
+	if nsec < 0 {
+		sec--
+		nsec += int64(time.Second)
+	}
+	return fmt.Sprintf("%d %d %d\n", clock, sec, nsec)
+}
+
+func timensOffsetsPath(pid int) string {
+	return filepath.Join(PROCFSPath, strconv.Itoa(pid), "timens_offsets")
+}
@@ -0,0 +1,87 @@
+package namespace
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const timensHelperEnv = "NAMESPACE_TEST_TIMENS_HELPER"
+
+// exec moves a process into its time_for_children ns so offsets can only be written to a process that
+// unshared and has neither forked nor exec'd. package init runs on the main thread which is the one
+// timens_offsets reports on.
+func init() {
+	if os.Getenv(timensHelperEnv) == "" {
+		return
+	}
+	if err := unix.Unshare(int(TIME)); err != nil {
+		os.Stdout.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+	os.Stdout.WriteString("ready\n")
+	bufio.NewReader(os.Stdin).ReadString('\n')
+	os.Exit(0)
+}
+
+func TestTimeOffsets(t *testing.T) {
+	c := exec.Command("/proc/self/exe")
+	c.Env = append(os.Environ(), timensHelperEnv+"=1")
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Wait()
+	defer stdin.Close()
+
+	if l, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || l != "ready\n" {
+		t.Fatalf("helper failed to unshare: %q %v", l, err)
+	}
+
+	ppid := c.Process.Pid
+
+	cur, err := FromPID(ppid, TIME)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cur.Close()
+
+	chld, err := ForChildren(ppid, TIME)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer chld.Close()
+
+	if chld.Type() != TIME {
+		t.Fatal("time_for_children type should be TIME instead of", chld.Type())
+	}
+	if chld.Ino() == cur.Ino() {
+		t.Fatal("time_for_children should be a new time ns")
+	}
+
+	off := TimeOffsets{
+		Monotonic: 3*time.Hour + 5*time.Millisecond,
+		Boottime:  -1500 * time.Millisecond,
+	}
+	if err := WriteTimeOffsets(ppid, off); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadTimeOffsets(ppid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != off {
+		t.Fatalf("expecting offsets %+v but got %+v", off, got)
+	}
+}
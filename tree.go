@@ -0,0 +1,158 @@
+package namespace
+
+import (
+	"errors"
+	"sort"
+)
+
+// Ancestors returns the parents of a pid or user namespace, closest first, up to the root of the
+// caller's namespace scope. The returned namespaces have to be closed by the caller.
+func (ns *Namespace) Ancestors() ([]*Namespace, error) {
+	out := []*Namespace{}
+	err := ns.walkAncestors(func(p *Namespace) error {
+		d, err := p.Dup()
+		if err != nil {
+			return err
+		}
+		out = append(out, d)
+		return nil
+	})
+	if err != nil {
+		for _, p := range out {
+			p.Close()
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// Depth returns the number of ancestors of a pid or user namespace in the caller's namespace scope
+func (ns *Namespace) Depth() (int, error) {
+	d := 0
+	err := ns.walkAncestors(func(p *Namespace) error {
+		d++
+		return nil
+	})
+	return d, err
+}
+
+// IsAncestorOf is true if ns is an ancestor of other. Both have to be pid or user namespaces
+func (ns *Namespace) IsAncestorOf(other *Namespace) (bool, error) {
+	if !(ns.typ == PID || ns.typ == USER) {
+		return false, ns.error("ancestor", ErrNonHierarchicalNS)
+	}
+	if ns.typ != other.typ {
+		return false, nil
+	}
+	id := ns.ID()
+	found := false
+	err := other.walkAncestors(func(p *Namespace) error {
+		if p.ID().Equal(id) {
+			found = true
+			return errStopWalk
+		}
+		return nil
+	})
+	if err == errStopWalk {
+		err = nil
+	}
+	return found, err
+}
+
+// errStopWalk is returned from a walkAncestors callback to stop early
+var errStopWalk = errors.New("stop walk")
+
+// walkAncestors calls fn for every parent of ns, closest first, until the root of the caller's namespace
+// scope or fn returns an error. Every parent is closed after fn returns.
+func (ns *Namespace) walkAncestors(fn func(p *Namespace) error) error {
+	cur, err := ns.Parent()
+	for err == nil {
+		if err = fn(cur); err == nil {
+			var p *Namespace
+			p, err = cur.Parent()
+			cur.Close()
+			cur = p
+			continue
+		}
+		cur.Close()
+	}
+	if errors.Is(err, ErrNotPermitted) {
+		return nil
+	}
+	return err
+}
+
+// Node is a namespace in the tree returned by Tree
+type Node struct {
+	ID       ID
+	Parent   *Node
+	Children []*Node
+}
+
+// Tree returns the roots of the hierarchy nss belong to, including any ancestors of them in the caller's
+// namespace scope. Pid and user namespaces are children of their parent, other types are children of their
+// owning user namespace. A root is either the initial namespace or the last one visible to the caller.
+func Tree(nss ...*Namespace) ([]*Node, error) {
+	b := &treeBuilder{
+		nodes: map[ID]*Node{},
+	}
+	for _, ns := range nss {
+		if _, err := b.add(ns); err != nil {
+			return nil, err
+		}
+	}
+	for _, n := range b.nodes {
+		sortNodes(n.Children)
+	}
+	sortNodes(b.roots)
+	return b.roots, nil
+}
+
+type treeBuilder struct {
+	nodes map[ID]*Node
+	roots []*Node
+}
+
+func (b *treeBuilder) add(ns *Namespace) (*Node, error) {
+	id := ns.ID()
+	if n, ok := b.nodes[id]; ok {
+		return n, nil
+	}
+	n := &Node{
+		ID: id,
+	}
+	b.nodes[id] = n
+
+	var p *Namespace
+	var err error
+	if ns.typ == PID || ns.typ == USER {
+		p, err = ns.Parent()
+	} else {
+		p, err = ns.OwningUserNS()
+	}
+	if errors.Is(err, ErrNotPermitted) {
+		b.roots = append(b.roots, n)
+		return n, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer p.Close()
+
+	pn, err := b.add(p)
+	if err != nil {
+		return nil, err
+	}
+	n.Parent = pn
+	pn.Children = append(pn.Children, n)
+	return n, nil
+}
+
+func sortNodes(nodes []*Node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].ID.Type != nodes[j].ID.Type {
+			return setnsIndex(nodes[i].ID.Type) < setnsIndex(nodes[j].ID.Type)
+		}
+		return nodes[i].ID.Ino < nodes[j].ID.Ino
+	})
+}
@@ -0,0 +1,153 @@
+package namespace
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAncestors(t *testing.T) {
+	m := NewMask().Set(USER).Set(PID).Set(NET)
+
+	c, err := newProcess(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+
+	ppid := c.Process.Pid
+
+	for _, nsType := range []Type{USER, PID} {
+		ns, err := FromPID(ppid, nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ns.Close()
+		self, err := Self(nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer self.Close()
+
+		selfDepth, err := self.Depth()
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := ns.Depth()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != selfDepth+1 {
+			t.Fatalf("expecting %s depth %d but got %d", nsType, selfDepth+1, d)
+		}
+
+		anc, err := ns.Ancestors()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(anc) != d {
+			t.Fatalf("expecting %d ancestors but got %d", d, len(anc))
+		}
+		if !anc[0].Equal(self) {
+			t.Fatal("closest ancestor should be own", nsType)
+		}
+		for _, a := range anc {
+			a.Close()
+		}
+
+		if ok, err := self.IsAncestorOf(ns); err != nil || !ok {
+			t.Fatal("own ns should be ancestor of child", nsType, err)
+		}
+		if ok, err := ns.IsAncestorOf(self); err != nil || ok {
+			t.Fatal("child ns should not be ancestor of own", nsType, err)
+		}
+	}
+
+	net, err := FromPID(ppid, NET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer net.Close()
+	if _, err := net.IsAncestorOf(net); !errors.Is(err, ErrNonHierarchicalNS) {
+		t.Fatal("expecting ErrNonHierarchicalNS but got", err)
+	}
+}
+
+func TestTree(t *testing.T) {
+	m := NewMask().Set(USER).Set(PID).Set(NET)
+
+	c, err := newProcess(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+
+	ppid := c.Process.Pid
+
+	nss := []*Namespace{}
+	for _, nsType := range m.Types() {
+		ns, err := FromPID(ppid, nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ns.Close()
+		nss = append(nss, ns)
+	}
+
+	roots, err := Tree(nss...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodes := map[ID]*Node{}
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		nodes[n.ID] = n
+		for _, c := range n.Children {
+			if c.Parent != n {
+				t.Fatal("child parent mismatch", c.ID)
+			}
+			walk(c)
+		}
+	}
+	for _, r := range roots {
+		if r.Parent != nil {
+			t.Fatal("root should not have a parent", r.ID)
+		}
+		walk(r)
+	}
+
+	user := nodes[nss[0].ID()]
+	pid := nodes[nss[2].ID()]
+	net := nodes[nss[1].ID()]
+	if user == nil || pid == nil || net == nil {
+		t.Fatal("tree is missing child namespaces")
+	}
+	if net.Parent != user {
+		t.Fatal("net ns should be a child of its owning user ns")
+	}
+
+	for _, nsType := range []Type{USER, PID} {
+		self, err := Self(nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := nodes[self.ID()]
+		self.Close()
+		if n == nil {
+			t.Fatal("own ns should be in tree", nsType)
+		}
+		chld := user
+		if nsType == PID {
+			chld = pid
+		}
+		if chld.Parent != n {
+			t.Fatal("child should be under own", nsType)
+		}
+	}
+}
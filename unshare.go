@@ -0,0 +1,74 @@
+package namespace
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// Unshare creates new namespaces of the types in m and returns them. The namespaces are created by a
+// dedicated OS thread that returns to its original namespaces afterwards, the caller's thread is not
+// affected. A thread that can't be returned, because it unshared a mount or time namespace or
+// restoring failed, exits instead. A new TIME namespace has no members until a process is started in
+// it, PID is not supported as its namespace file can't be opened before then. Like Namespace.Set, a new
+// user namespace can't be created by a multi threaded process.
+func Unshare(m Mask) (map[Type]*Namespace, error) {
+	if m.Has(PID) {
+		return nil, NewError("unshare", "", PID, ErrUnsharePID)
+	}
+	out := map[Type]*Namespace{}
+	var err error
+	onLockedThread(func() bool {
+		saved := []*Namespace{}
+		defer func() {
+			for _, ns := range saved {
+				ns.Close()
+			}
+		}()
+		for _, t := range m.Types() {
+			ns, e := Self(t)
+			if e != nil {
+				err = e
+				return true
+			}
+			saved = append(saved, ns)
+		}
+		if e := unix.Unshare(int(m)); e != nil {
+			err = NewError("unshare", "", INVALID, e)
+			return true
+		}
+		for _, t := range m.Types() {
+			var ns *Namespace
+			var e error
+			if t == TIME {
+				// the thread stays where it is and only its children enter the new one
+				ns, e = fromPath(filepath.Join(PROCFSPath, "thread-self", "ns", "time_for_children"), t)
+			} else {
+				ns, e = ThreadSelf(t)
+			}
+			if e != nil {
+				err = e
+				break
+			}
+			out[t] = ns
+		}
+		// the kernel doesn't allow a multi threaded process to setns a time namespace and a mount
+		// namespace leaves the thread with its own filesystem attributes
+		if m.Has(MNT) || m.Has(TIME) {
+			return false
+		}
+		for _, ns := range saved {
+			if e := ns.Set(); e != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		for _, ns := range out {
+			ns.Close()
+		}
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,46 @@
+package namespace
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUnshare(t *testing.T) {
+	m := NewMask().SetAll().Remove(USER).Remove(PID)
+
+	nss, err := Unshare(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, nsType := range m.Types() {
+		ns, ok := nss[nsType]
+		if !ok {
+			t.Fatal("no new namespace for", nsType)
+		}
+		defer ns.Close()
+		if ns.Type() != nsType {
+			t.Fatalf("expecting %s ns but got %s", nsType, ns.Type())
+		}
+		self, err := Self(nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if self.Ino() == ns.Ino() {
+			t.Fatal("unshare should have created a new", nsType)
+		}
+		self.Close()
+	}
+
+	ino, err := threadIno(NET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ino == nss[NET].Ino() {
+		t.Fatal("the calling thread should not be in the new net ns")
+	}
+
+	if _, err := Unshare(NewMask().Set(PID)); !errors.Is(err, ErrUnsharePID) {
+		t.Fatal("expecting ErrUnsharePID but got", err)
+	}
+}
@@ -0,0 +1,74 @@
+package namespace
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// MaxUTSNameLen is the longest hostname or domainname the kernel accepts
+const MaxUTSNameLen = 64
+
+// Utsname are the names returned by Uname
+type Utsname struct {
+	Sysname    string
+	Nodename   string
+	Release    string
+	Version    string
+	Machine    string
+	Domainname string
+}
+
+// SetHostname sets the hostname of the uts namespace ns. The caller's namespaces are not changed
+func SetHostname(ns *Namespace, name string) error {
+	if len(name) > MaxUTSNameLen {
+		return ns.error("set hostname", ErrNameTooLong)
+	}
+	return ns.doAs(UTS, "set hostname", ErrNonUTSNS, func() error {
+		if err := unix.Sethostname([]byte(name)); err != nil {
+			return ns.error("set hostname", err)
+		}
+		return nil
+	})
+}
+
+// SetDomainname sets the NIS domain name of the uts namespace ns. The caller's namespaces are not changed
+func SetDomainname(ns *Namespace, name string) error {
+	if len(name) > MaxUTSNameLen {
+		return ns.error("set domainname", ErrNameTooLong)
+	}
+	return ns.doAs(UTS, "set domainname", ErrNonUTSNS, func() error {
+		if err := unix.Setdomainname([]byte(name)); err != nil {
+			return ns.error("set domainname", err)
+		}
+		return nil
+	})
+}
+
+// Uname returns the names of the uts namespace ns, see uname(2)
+func Uname(ns *Namespace) (Utsname, error) {
+	out := Utsname{}
+	err := ns.doAs(UTS, "uname", ErrNonUTSNS, func() error {
+		u := unix.Utsname{}
+		if err := unix.Uname(&u); err != nil {
+			return ns.error("uname", err)
+		}
+		out = Utsname{
+			Sysname:    utsString(u.Sysname[:]),
+			Nodename:   utsString(u.Nodename[:]),
+			Release:    utsString(u.Release[:]),
+			Version:    utsString(u.Version[:]),
+			Machine:    utsString(u.Machine[:]),
+			Domainname: utsString(u.Domainname[:]),
+		}
+		return nil
+	})
+	return out, err
+}
+
+func utsString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
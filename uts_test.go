@@ -0,0 +1,65 @@
+package namespace
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUTS(t *testing.T) {
+	c, err := newProcess(NewMask().Set(UTS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		c.Process.Kill()
+		c.Wait()
+	}()
+	ns, err := FromPID(c.Process.Pid, UTS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ns.Close()
+
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetHostname(ns, "uts-test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetDomainname(ns, "example.org"); err != nil {
+		t.Fatal(err)
+	}
+	u, err := Uname(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Nodename != "uts-test" || u.Domainname != "example.org" || u.Sysname != "Linux" {
+		t.Fatalf("unexpected uname %+v", u)
+	}
+	if h, _ := os.Hostname(); h != host {
+		t.Fatalf("expecting our hostname %s but got %s", host, h)
+	}
+
+	long := strings.Repeat("a", MaxUTSNameLen+1)
+	if err := SetHostname(ns, long); !errors.Is(err, ErrNameTooLong) {
+		t.Fatal("expecting ErrNameTooLong but got", err)
+	}
+	if err := SetDomainname(ns, long); !errors.Is(err, ErrNameTooLong) {
+		t.Fatal("expecting ErrNameTooLong but got", err)
+	}
+	if err := SetHostname(ns, long[:MaxUTSNameLen]); err != nil {
+		t.Fatal(err)
+	}
+
+	net, err := Self(NET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer net.Close()
+	if _, err := Uname(net); !errors.Is(err, ErrNonUTSNS) {
+		t.Fatal("expecting ErrNonUTSNS but got", err)
+	}
+}